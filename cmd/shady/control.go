@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/billtraill/shady/playlist"
+	"github.com/billtraill/shady/renderer"
+	"github.com/billtraill/shady/shadertoy"
+)
+
+// controlledEngine is an engine that can be controlled while it renders.
+type controlledEngine interface {
+	SetEnvironment(renderer.Environment)
+	Control(ctx context.Context, fn func(*renderer.EngineState)) error
+}
+
+// uniformSetter is an environment that can set its uniforms to fixed values.
+type uniformSetter interface {
+	SetUniform(name string, values []float32)
+}
+
+// paramEnvironment is an environment that declares parameters.
+type paramEnvironment interface {
+	Params() []shadertoy.Param
+	ParamValues() map[string][]float32
+	SetParam(name string, values []float32) error
+}
+
+// controlServer serves the HTTP API of -control. Every change is applied by
+// the engine between two frames.
+type controlServer struct {
+	engine controlledEngine
+	// newEnvironment creates the environment of shader files and mappings.
+	newEnvironment func(shaders, mappings []string) (renderer.Environment, error)
+	// params are the values of -param and -preset.
+	params *paramValues
+
+	lock     sync.Mutex
+	shaders  []string
+	mappings []string
+}
+
+type controlUniform struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type controlParam struct {
+	Name    string    `json:"name"`
+	Type    string    `json:"type"`
+	Default []float32 `json:"default"`
+	Min     []float32 `json:"min,omitempty"`
+	Max     []float32 `json:"max,omitempty"`
+	Value   []float32 `json:"value"`
+}
+
+type controlEnvironment struct {
+	Shaders  []string  `json:"shaders,omitempty"`
+	Mappings *[]string `json:"map,omitempty"`
+}
+
+type controlClock struct {
+	Time   *float64 `json:"time,omitempty"`
+	Paused *bool    `json:"paused,omitempty"`
+}
+
+type controlStats struct {
+	Time      float64 `json:"time"`
+	Frame     uint64  `json:"frame"`
+	Paused    bool    `json:"paused"`
+	FPS       float64 `json:"fps"`
+	Errors    int     `json:"errors"`
+	LastError string  `json:"lastError,omitempty"`
+}
+
+// listen starts serving the API on the address, e.g. ":9000".
+func (srv *controlServer) listen(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := http.Serve(lis, srv.handler()); err != nil {
+			log.Printf("Control server error: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (srv *controlServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/uniforms", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			srv.getUniforms(w, r)
+		case http.MethodPut, http.MethodPost:
+			srv.setUniforms(w, r)
+		default:
+			methodNotAllowed(w, "GET, PUT, POST")
+		}
+	})
+	mux.HandleFunc("/params", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			srv.getParams(w, r)
+		case http.MethodPut, http.MethodPost:
+			srv.setParams(w, r)
+		default:
+			methodNotAllowed(w, "GET, PUT, POST")
+		}
+	})
+	mux.HandleFunc("/preset", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodPost:
+			srv.preset(w, r)
+		default:
+			methodNotAllowed(w, "GET, POST")
+		}
+	})
+	mux.HandleFunc("/environment", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			srv.lock.Lock()
+			mappings := append([]string{}, srv.mappings...)
+			env := controlEnvironment{Shaders: srv.shaders, Mappings: &mappings}
+			srv.lock.Unlock()
+			writeJSON(w, env)
+		case http.MethodPut, http.MethodPost:
+			srv.setEnvironment(w, r)
+		default:
+			methodNotAllowed(w, "GET, PUT, POST")
+		}
+	})
+	mux.HandleFunc("/clock", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodPut, http.MethodPost:
+			srv.clock(w, r)
+		default:
+			methodNotAllowed(w, "GET, PUT, POST")
+		}
+	})
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, "GET")
+			return
+		}
+		var stats controlStats
+		err := srv.engine.Control(r.Context(), func(state *renderer.EngineState) {
+			stats = controlStats{
+				Time:   state.Time.Seconds(),
+				Frame:  state.Frame,
+				Paused: state.Paused,
+				FPS:    state.FPS,
+				Errors: state.Errors,
+			}
+			if state.LastError != nil {
+				stats.LastError = state.LastError.Error()
+			}
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, stats)
+	})
+	return mux
+}
+
+// getUniforms lists the active uniforms of the environment that is rendered.
+func (srv *controlServer) getUniforms(w http.ResponseWriter, r *http.Request) {
+	uniforms := []controlUniform{}
+	err := srv.engine.Control(r.Context(), func(state *renderer.EngineState) {
+		for _, u := range state.Uniforms {
+			uniforms = append(uniforms, controlUniform{Name: u.Name, Type: u.TypeLiteral()})
+		}
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	sort.Slice(uniforms, func(i, j int) bool {
+		return uniforms[i].Name < uniforms[j].Name
+	})
+	writeJSON(w, uniforms)
+}
+
+// setUniforms sets uniforms to the values of a JSON object, e.g.
+// {"speed": 2.5, "tint": [1, 0.5, 0]}. No uniform is set if any is invalid.
+func (srv *controlServer) setUniforms(w http.ResponseWriter, r *http.Request) {
+	var values map[string]playlist.Values
+	if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var setErr error
+	err := srv.engine.Control(r.Context(), func(state *renderer.EngineState) {
+		setter, ok := state.Environment.(uniformSetter)
+		if !ok {
+			setErr = fmt.Errorf("the environment can not set uniforms")
+			return
+		}
+		for name, v := range values {
+			u, ok := state.Uniforms[name]
+			if !ok {
+				setErr = fmt.Errorf("unknown uniform %q", name)
+				return
+			}
+			if n := u.Components(); n == 0 || n != len(v) {
+				setErr = fmt.Errorf("uniform %q is a %s, which can not be set to %v", name, u.TypeLiteral(), v)
+				return
+			}
+		}
+		for name, v := range values {
+			setter.SetUniform(name, v)
+		}
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if setErr != nil {
+		http.Error(w, setErr.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getParams lists the parameters of the environment that is rendered with
+// their values.
+func (srv *controlServer) getParams(w http.ResponseWriter, r *http.Request) {
+	params := []controlParam{}
+	err := srv.engine.Control(r.Context(), func(state *renderer.EngineState) {
+		env, ok := state.Environment.(paramEnvironment)
+		if !ok {
+			return
+		}
+		values := env.ParamValues()
+		for _, p := range env.Params() {
+			params = append(params, controlParam{
+				Name:    p.Name,
+				Type:    p.Type,
+				Default: p.Default,
+				Min:     p.Min,
+				Max:     p.Max,
+				Value:   values[p.Name],
+			})
+		}
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, params)
+}
+
+// setParams sets parameters to the values of a JSON object in the format of a
+// preset. No parameter is set if any is invalid.
+func (srv *controlServer) setParams(w http.ResponseWriter, r *http.Request) {
+	var values map[string]playlist.Values
+	if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var setErr error
+	err := srv.engine.Control(r.Context(), func(state *renderer.EngineState) {
+		env, ok := state.Environment.(paramEnvironment)
+		if !ok {
+			setErr = fmt.Errorf("the environment has no parameters")
+			return
+		}
+		params := map[string]shadertoy.Param{}
+		for _, p := range env.Params() {
+			params[p.Name] = p
+		}
+		for name, v := range values {
+			p, ok := params[name]
+			if !ok {
+				setErr = fmt.Errorf("unknown parameter %q", name)
+				return
+			}
+			if setErr = p.Check(v); setErr != nil {
+				return
+			}
+		}
+		for name, v := range values {
+			env.SetParam(name, v)
+		}
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if setErr != nil {
+		http.Error(w, setErr.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// preset responds with the values of the parameters of the environment that
+// is rendered as a preset. POST saves them to the preset file.
+func (srv *controlServer) preset(w http.ResponseWriter, r *http.Request) {
+	values := map[string][]float32{}
+	err := srv.engine.Control(r.Context(), func(state *renderer.EngineState) {
+		if env, ok := state.Environment.(paramEnvironment); ok {
+			values = env.ParamValues()
+		}
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method == http.MethodPost {
+		if err := srv.params.save(values); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	data, err := presetJSON(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
+
+// setEnvironment switches the shaders or mappings that are rendered. Fields
+// that are not set keep their values. Errors that occur while the new
+// environment is set up are reported by /stats.
+func (srv *controlServer) setEnvironment(w http.ResponseWriter, r *http.Request) {
+	var req controlEnvironment
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	shaders, mappings := srv.shaders, srv.mappings
+	if len(req.Shaders) > 0 {
+		shaders = req.Shaders
+	}
+	if req.Mappings != nil {
+		mappings = *req.Mappings
+	}
+	if len(shaders) == 0 {
+		http.Error(w, "no shaders are set", http.StatusBadRequest)
+		return
+	}
+	env, err := srv.newEnvironment(shaders, mappings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	srv.engine.SetEnvironment(env)
+	srv.shaders, srv.mappings = shaders, mappings
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clock pauses, resumes or seeks the animation and responds with its state.
+func (srv *controlServer) clock(w http.ResponseWriter, r *http.Request) {
+	var req controlClock
+	if r.Method != http.MethodGet {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Time != nil && *req.Time < 0 {
+			http.Error(w, "the time can not be negative", http.StatusBadRequest)
+			return
+		}
+	}
+	var t float64
+	var paused bool
+	err := srv.engine.Control(r.Context(), func(state *renderer.EngineState) {
+		if req.Time != nil {
+			state.Time = time.Duration(*req.Time * float64(time.Second))
+		}
+		if req.Paused != nil {
+			state.Paused = *req.Paused
+		}
+		t, paused = state.Time.Seconds(), state.Paused
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, controlClock{Time: &t, Paused: &paused})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Control server error: %v", err)
+	}
+}
+
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
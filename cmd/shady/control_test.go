@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/billtraill/shady/renderer"
+	"github.com/billtraill/shady/shadertoy"
+)
+
+type testEnvironment struct {
+	renderer.Environment
+	uniforms map[string][]float32
+}
+
+func (env *testEnvironment) SetUniform(name string, values []float32) {
+	env.uniforms[name] = values
+}
+
+// testEngine applies controls immediately.
+type testEngine struct {
+	state renderer.EngineState
+	envs  []renderer.Environment
+}
+
+func (eng *testEngine) SetEnvironment(env renderer.Environment) {
+	eng.envs = append(eng.envs, env)
+}
+
+func (eng *testEngine) Control(ctx context.Context, fn func(*renderer.EngineState)) error {
+	fn(&eng.state)
+	return nil
+}
+
+func TestControlServer(t *testing.T) {
+	env := &testEnvironment{uniforms: map[string][]float32{}}
+	engine := &testEngine{state: renderer.EngineState{
+		Environment: env,
+		Uniforms: map[string]renderer.Uniform{
+			"speed": {Name: "speed", Type: gl.FLOAT},
+			"tint":  {Name: "tint", Type: gl.FLOAT_VEC3},
+		},
+		Time:      2 * time.Second,
+		Frame:     120,
+		Errors:    1,
+		LastError: errors.New("compile error"),
+	}}
+	var created [][]string
+	srv := &controlServer{
+		engine: engine,
+		newEnvironment: func(shaders, mappings []string) (renderer.Environment, error) {
+			created = append(created, shaders, mappings)
+			return &testEnvironment{}, nil
+		},
+	}
+	handler := srv.handler()
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := request(http.MethodGet, "/uniforms", "")
+	var uniforms []controlUniform
+	if err := json.Unmarshal(rec.Body.Bytes(), &uniforms); err != nil {
+		t.Fatal(err)
+	}
+	if exp := []controlUniform{{"speed", "float"}, {"tint", "vec3"}}; !reflect.DeepEqual(uniforms, exp) {
+		t.Errorf("unexpected uniforms: %v", uniforms)
+	}
+
+	for _, body := range []string{`{"speed": 1, "unknown": 1}`, `{"speed": 1, "tint": [1, 0]}`, `{"speed": "fast"}`} {
+		if rec := request(http.MethodPut, "/uniforms", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected a bad request for %s, got %d", body, rec.Code)
+		}
+	}
+	if len(env.uniforms) != 0 {
+		t.Errorf("uniforms were set by invalid requests: %v", env.uniforms)
+	}
+	if rec := request(http.MethodPut, "/uniforms", `{"speed": 2.5, "tint": [1, 0.5, 0]}`); rec.Code != http.StatusNoContent {
+		t.Errorf("unexpected status: %d: %s", rec.Code, rec.Body)
+	}
+	if exp := map[string][]float32{"speed": {2.5}, "tint": {1, 0.5, 0}}; !reflect.DeepEqual(env.uniforms, exp) {
+		t.Errorf("unexpected uniform values: %v", env.uniforms)
+	}
+
+	rec = request(http.MethodPut, "/clock", `{"time": 10, "paused": true}`)
+	if engine.state.Time != 10*time.Second || !engine.state.Paused {
+		t.Errorf("the clock was not set: %v, %v", engine.state.Time, engine.state.Paused)
+	}
+	if body := strings.TrimSpace(rec.Body.String()); body != `{"time":10,"paused":true}` {
+		t.Errorf("unexpected clock: %s", body)
+	}
+
+	rec = request(http.MethodGet, "/stats", "")
+	if body := strings.TrimSpace(rec.Body.String()); body != `{"time":10,"frame":120,"paused":true,"fps":0,"errors":1,"lastError":"compile error"}` {
+		t.Errorf("unexpected stats: %s", body)
+	}
+
+	if rec := request(http.MethodPut, "/environment", `{"map": ["a=image:a.png"]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a bad request without shaders, got %d", rec.Code)
+	}
+	request(http.MethodPut, "/environment", `{"shaders": ["a.glsl"], "map": ["a=image:a.png"]}`)
+	request(http.MethodPut, "/environment", `{"shaders": ["b.glsl"]}`)
+	exp := [][]string{{"a.glsl"}, {"a=image:a.png"}, {"b.glsl"}, {"a=image:a.png"}}
+	if !reflect.DeepEqual(created, exp) || len(engine.envs) != 2 {
+		t.Errorf("unexpected environments: %v, %d", created, len(engine.envs))
+	}
+
+	if rec := request(http.MethodDelete, "/stats", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status: %d", rec.Code)
+	}
+}
+
+type testParamEnvironment struct {
+	renderer.Environment
+	params []shadertoy.Param
+	values map[string][]float32
+}
+
+func (env *testParamEnvironment) Params() []shadertoy.Param {
+	return env.params
+}
+
+func (env *testParamEnvironment) ParamValues() map[string][]float32 {
+	return env.values
+}
+
+func (env *testParamEnvironment) SetParam(name string, values []float32) error {
+	env.values[name] = values
+	return nil
+}
+
+func TestControlServerParams(t *testing.T) {
+	env := &testParamEnvironment{
+		params: []shadertoy.Param{
+			{Name: "speed", Type: "float", Default: []float32{1}, Min: []float32{0}, Max: []float32{10}},
+			{Name: "invert", Type: "bool", Default: []float32{0}},
+		},
+		values: map[string][]float32{"speed": {1}, "invert": {0}},
+	}
+	filename := filepath.Join(t.TempDir(), "preset.json")
+	srv := &controlServer{
+		engine: &testEngine{state: renderer.EngineState{Environment: env}},
+		params: &paramValues{presetFile: filename},
+	}
+	handler := srv.handler()
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := request(http.MethodGet, "/params", "")
+	exp := `[{"name":"speed","type":"float","default":[1],"min":[0],"max":[10],"value":[1]},{"name":"invert","type":"bool","default":[0],"value":[0]}]`
+	if body := strings.TrimSpace(rec.Body.String()); body != exp {
+		t.Errorf("unexpected parameters: %s", body)
+	}
+
+	for _, body := range []string{`{"speed": 20}`, `{"speed": 2, "unknown": 1}`, `{"invert": [1, 0]}`} {
+		if rec := request(http.MethodPut, "/params", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected a bad request for %s, got %d", body, rec.Code)
+		}
+	}
+	if rec := request(http.MethodPut, "/params", `{"speed": 2.5, "invert": true}`); rec.Code != http.StatusNoContent {
+		t.Errorf("unexpected status: %d: %s", rec.Code, rec.Body)
+	}
+	if exp := map[string][]float32{"speed": {2.5}, "invert": {1}}; !reflect.DeepEqual(env.values, exp) {
+		t.Errorf("unexpected values: %v", env.values)
+	}
+
+	if rec := request(http.MethodPost, "/preset", ""); rec.Code != http.StatusOK {
+		t.Errorf("unexpected status: %d: %s", rec.Code, rec.Body)
+	}
+	preset, err := loadPreset(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(preset, env.values) {
+		t.Errorf("unexpected preset: %v", preset)
+	}
+}
@@ -22,13 +22,16 @@ import (
 	"github.com/fsnotify/fsnotify"
 
 	"github.com/billtraill/shady/encode"
+	"github.com/billtraill/shady/playlist"
 	"github.com/billtraill/shady/renderer"
 	"github.com/billtraill/shady/shadertoy"
 	_ "github.com/billtraill/shady/shadertoy/audio"
 	_ "github.com/billtraill/shady/shadertoy/image"
 	_ "github.com/billtraill/shady/shadertoy/imu"
+	_ "github.com/billtraill/shady/shadertoy/osc"
 	_ "github.com/billtraill/shady/shadertoy/peripheral"
 	_ "github.com/billtraill/shady/shadertoy/video"
+	"github.com/billtraill/shady/transition"
 )
 
 func main() {
@@ -37,6 +40,15 @@ func main() {
 	// OpenGL contexts are bounds to threads.
 	runtime.LockOSThread()
 
+	if len(os.Args) > 1 && os.Args[1] == "play" {
+		play(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		render(os.Args[2:])
+		return
+	}
+
 	formatNames := make([]string, 0, len(encode.Formats))
 	for name := range encode.Formats {
 		formatNames = append(formatNames, name)
@@ -44,27 +56,111 @@ func main() {
 
 	var inputFiles arrayFlags
 	flag.Var(&inputFiles, "i", "The shader file(s) to use")
-	outputFile := flag.String("o", "-", "The file to write the rendered image to")
+	var outputFiles arrayFlags
+	flag.Var(&outputFiles, "o", "The file to write the rendered image to, \"-\" by default. For serial formats, this is the device as DEVICE[;BAUDRATE]. For the http format, this is the address to listen on, e.g. :8080. A frame number verb like frame_%05d.png writes each frame to a separate file. May be repeated to write to multiple outputs, the format of each can be set as FORMAT://FILE and its buffering as FILE?buffer=N&drop=POLICY")
 	geometry := flag.String("g", "env", "The geometry of the rendered image in WIDTHxHEIGHT format. If \"env\", look for the LEDCAT_GEOMETRY variable")
-	outputFormat := flag.String("ofmt", "x11", "The encoding format to use to output the image. Valid values are: "+strings.Join(append(formatNames, "x11"), ", "))
+	outputFormat := flag.String("ofmt", "x11", "The encoding format to use to output the image. If not set, the format is detected from the extension of the -o file if possible. Valid values are: "+strings.Join(append(formatNames, "x11"), ", "))
+	outputBuffer := flag.Int("obuf", 10, "The number of frames that are buffered for each output")
+	outputDrop := flag.String("odrop", dropBlock, "What to do with frames for an output that has a full buffer. Valid values are: block, oldest, newest")
 	framerate := flag.Float64("f", 0, "Whether to animate using the specified number of frames per second")
 	numFrames := flag.Uint("n", 0, "Limit the number of frames in the animation. No limit is set by default")
 	duration := flag.Float64("d", 0.0, "Limit the animation to the specified number of seconds. No limit is set by default")
 	framerateOld := flag.Float64("framerate", 0, "Whether to animate using the specified number of frames per second")
 	numFramesOld := flag.Uint("numframes", 0, "Limit the number of frames in the animation. No limit is set by default")
 	durationOld := flag.Float64("duration", 0.0, "Limit the animation to the specified number of seconds. No limit is set by default")
+	start := flag.Float64("start", 0.0, "Start the animation at the specified number of seconds")
+	startFrame := flag.Uint("start-frame", 0, "Start the animation at the specified frame, like -start")
+	preroll := flag.Uint("preroll", 0, "Render the specified number of frames before the start of the animation without outputting them, so shaders that use the previous frame or buffers can warm up")
+	date := flag.String("date", "", "Make the date seen by shaders follow the animation time, starting at the specified date in RFC 3339 format, e.g. 2021-06-21T12:00:00Z. The actual date is used by default")
 	realtime := flag.Bool("rt", false, "Render at the actual number of frames per second set by -framerate")
 	verbose := flag.Bool("v", false, "Show verbose output about rendering")
 	watch := flag.Bool("w", false, "Watch the shader source files for changes")
 	glslVersion := flag.String("glsl", "330", "The GLSL version to use")
 	openGLVersionStr := flag.String("opengl", "glsl", "The OpenGL version to use. If \"glsl\", the version is inferred from the requested GLSL version")
+	seqStart := flag.Int("seq-start", 0, "The number of the first frame when writing an image sequence")
+	seqWorkers := flag.Int("seq-workers", runtime.NumCPU(), "The number of frames to encode in parallel when writing an image sequence")
+	seqSkipExisting := flag.Bool("seq-skip-existing", false, "Do not overwrite frames that already exist when writing an image sequence")
+	gifPalette := flag.String("gif-palette", encode.GIFPaletteFrame, "The palette of GIF output. Valid values are: frame, global, plan9")
+	gifDither := flag.String("gif-dither", encode.GIFDitherFloydSteinberg, "The dithering method of GIF output. Valid values are: floyd-steinberg, ordered, none")
+	ffmpegArgs := flag.String("ffmpeg-args", "", "Additional output arguments for FFmpeg when encoding video, e.g. \"-c:v libx264 -crf 18\"")
+	pixelFormatStr := flag.String("pixfmt", "auto", "The pixel format to render with. If \"auto\", a floating point format is used for HDR outputs like exr. Valid values are: auto, rgba8, rgba16f, rgba32f")
+	tileSize := flag.Uint("tile", 0, fmt.Sprintf("Render images that are wider or higher than the specified number of pixels in tiles. Images larger than %d pixels are always rendered in tiles", renderer.MaxTileSize))
+	supersample := flag.Uint("ss", 1, "Reduce aliasing by rendering each pixel as NxN samples that are averaged, e.g. for LED displays with few pixels")
+	exrCompression := flag.String("exr-compression", encode.EXRCompressionZIP, "The compression of OpenEXR output. Valid values are: zip, none")
+	soundtrackFile := flag.String("soundtrack", "mapping", "The audio file to add to encoded video. If \"mapping\", the file of the first audio mapping is used")
+	recordFormatName := flag.String("record-fmt", "mp4", "The format of recordings that are started with the R key in the x11 output")
+	fullscreen := flag.Bool("fullscreen", false, "Show the x11 output fullscreen")
+	monitor := flag.String("monitor", "", "The index or name of the monitor to show the x11 output on. The primary monitor is used by default")
+	windowGeometry := flag.String("window", "1366x768", "The size and optionally the position of the x11 window relative to the monitor in WIDTHxHEIGHT[+X+Y] format")
+	borderless := flag.Bool("borderless", false, "Hide the border and title bar of the x11 window")
+	renderSize := flag.String("render-size", "", "Render the x11 output at a fixed size in WIDTHxHEIGHT format which is scaled to the window. By default, the size of the window is used")
+	renderScale := flag.Float64("render-scale", 1, "Render the x11 output at the size of the window multiplied by the specified factor, e.g. 0.5 for heavy shaders on large monitors")
+	scaleFilterStr := flag.String("filter", "linear", "How the x11 output is scaled to the window. \"integer\" scales by whole factors preserving the aspect ratio and is the default if -g is set. Valid values are: nearest, linear, integer")
+	vsync := flag.Bool("vsync", true, "Synchronize the x11 output to the refresh rate of the monitor")
+	playlistFile := flag.String("playlist", "", "Play the shaders listed in a playlist file instead of -i")
+	transitionName := flag.String("transition", "fade", "The transition to a shader that is reloaded by -w or switched with -control. This is the name of a built-in transition or a GL Transitions file. Valid built-in transitions are: fade, wipe, dissolve, zoom")
+	transitionDuration := flag.Float64("transition-duration", 0, "The duration of the transition to a shader that is reloaded by -w or switched with -control in seconds. No transition is used by default. Transitions are not supported by the x11 output")
+	controlAddr := flag.String("control", "", "Serve an HTTP API to control the animation on the specified address, e.g. :9000")
+	presetFile := flag.String("preset", "", "Read the values of parameters declared with #pragma param from the specified JSON file. The current values can be saved to it with -control")
+	var paramFlags arrayFlags
+	flag.Var(&paramFlags, "param", "Set a parameter declared with #pragma param as NAME=VALUE, e.g. speed=2.5 or color=1,0.5,0. Overrides -preset")
 	var shadertoyMappings arrayFlags
 	flag.Var(&shadertoyMappings, "map", "Specify or override ShaderToy input mappings")
 	flag.Parse()
 
-	if len(inputFiles) == 0 {
+	params := &paramValues{
+		presetFile: *presetFile,
+		flags:      map[string][]float32{},
+	}
+	for _, str := range paramFlags {
+		name, values, err := parseParamFlag(str)
+		if err != nil {
+			log.Fatal(err)
+		}
+		params.flags[name] = values
+	}
+	if *presetFile != "" {
+		// The preset file is created when it is saved.
+		var err error
+		if params.preset, err = loadPreset(*presetFile); err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
+		}
+	}
+
+	var pl *playlist.Playlist
+	if *playlistFile != "" {
+		if len(inputFiles) > 0 || *watch {
+			log.Fatalf("-playlist can not be combined with -i or -w")
+		}
+		var err error
+		if pl, err = playlist.Load(*playlistFile); err != nil {
+			log.Fatal(err)
+		}
+	} else if len(inputFiles) == 0 {
 		log.Fatalf("Please specify at least one GLSL file with -i")
 	}
+	if len(outputFiles) == 0 {
+		outputFiles = append(outputFiles, "-")
+	}
+	formatFlag := ""
+	if isFlagSet("ofmt") {
+		formatFlag = *outputFormat
+	}
+	var outputs []*output
+	for _, value := range outputFiles {
+		o, err := parseOutput(value, formatFlag, *outputBuffer, *outputDrop)
+		if err != nil && formatFlag == "" && len(outputFiles) == 1 {
+			// A single output that has no detectable format uses the default.
+			o, err = parseOutput(value, *outputFormat, *outputBuffer, *outputDrop)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if o.formatName == "x11" && len(outputFiles) > 1 {
+			log.Fatalf("The x11 output can not be combined with other outputs")
+		}
+		outputs = append(outputs, o)
+	}
 	if *framerateOld != 0 {
 		log.Println("-framerate is deprecated, please use -f")
 		*framerate = *framerateOld
@@ -101,6 +197,34 @@ func main() {
 		log.Fatalf("-rt is set while -framerate is not set")
 	}
 	interval := time.Duration(float64(time.Second) / *framerate)
+	startTime := time.Duration(*start * float64(time.Second))
+	if startTime < 0 {
+		log.Fatalf("-start can not be negative")
+	}
+	if *startFrame != 0 {
+		if *start != 0.0 {
+			log.Fatalf("-start and -start-frame are mutually exclusive")
+		}
+		if *framerate == 0 {
+			log.Fatalf("-start-frame is set while -framerate is not set")
+		}
+		startTime = time.Duration(*startFrame) * interval
+	}
+	// The preroll can not start before time zero.
+	prerollFrames := *preroll
+	if *framerate == 0 {
+		prerollFrames = 0
+	} else if max := uint(startTime / interval); prerollFrames > max {
+		prerollFrames = max
+	}
+	clockStart := startTime - time.Duration(prerollFrames)*interval
+	var epoch time.Time
+	if *date != "" {
+		var err error
+		if epoch, err = time.Parse(time.RFC3339, *date); err != nil {
+			log.Fatalf("Invalid -date: %v", err)
+		}
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -131,13 +255,14 @@ func main() {
 		log.Printf("GLSL version: %s", *glslVersion)
 	}
 
-	newFn := func() (renderer.Environment, []string, error) {
-		sources, err := renderer.Includes([]string(inputFiles)...)
+	// newShaderToy creates the environment of a shader. The mappings take
+	// precedence over those set with -map.
+	newShaderToy := func(files []string, mappings []shadertoy.Mapping) (*shadertoy.ShaderToy, []string, error) {
+		sources, err := renderer.Includes(files...)
 		if err != nil {
 			return nil, sources, err
 		}
 
-		mappings := make([]shadertoy.Mapping, 0, len(shadertoyMappings))
 		for _, str := range shadertoyMappings {
 			m, err := shadertoy.ParseMapping(str, ".")
 			if err != nil {
@@ -150,20 +275,101 @@ func main() {
 			mappings,
 			*glslVersion,
 		)
-		return env, sources, err
+		if err != nil {
+			return nil, sources, err
+		}
+		if err := params.apply(env); err != nil {
+			return nil, sources, err
+		}
+		return env, sources, nil
 	}
-
-	// Check whether we should render directly to an onscreen window. This is a
-	// separate rendering path.
-	if *outputFormat == "x11" {
-		engine, err := renderer.NewOnScreenEngine(openGLVersion)
+	newEntryFn := func(e *playlist.Entry) (renderer.Environment, error) {
+		mappings := make([]shadertoy.Mapping, 0, len(e.Mappings))
+		for _, str := range e.Mappings {
+			m, err := shadertoy.ParseMapping(str, e.Dir)
+			if err != nil {
+				return nil, err
+			}
+			mappings = append(mappings, m)
+		}
+		env, _, err := newShaderToy(e.Shaders, mappings)
 		if err != nil {
-			log.Fatalf("Couldn't initialize engine: %v", err)
+			return nil, err
 		}
-		defer engine.Close()
-
-		if *watch {
-			go watchEnvironment(ctx, engine, newFn)
+		uniforms := make(map[string][]float32, len(e.Uniforms))
+		for name, values := range e.Uniforms {
+			uniforms[name] = values
+		}
+		env.SetUniforms(uniforms)
+		return env, nil
+	}
+	newFn := func() (renderer.Environment, []string, error) {
+		if pl != nil {
+			env, err := newEntryFn(&pl.Entries[0])
+			return env, nil, err
+		}
+		env, sources, err := newShaderToy(inputFiles, nil)
+		if err != nil {
+			return nil, sources, err
+		}
+		return env, sources, nil
+	}
+	// transitionFn wraps an environment in the transition set with
+	// -transition.
+	transitionFn := func(env renderer.Environment) renderer.Environment {
+		if *transitionDuration <= 0 {
+			return env
+		}
+		source, err := transition.Load(*transitionName)
+		if err != nil {
+			log.Println(err)
+			return env
+		}
+		return transition.New(env, source, time.Duration(*transitionDuration*float64(time.Second)), *glslVersion)
+	}
+	// startControl starts the server of -control if it is set.
+	startControl := func(engine controlledEngine) {
+		if *controlAddr == "" {
+			return
+		}
+		srv := &controlServer{
+			engine:  engine,
+			params:  params,
+			shaders: inputFiles,
+			newEnvironment: func(shaders, mappingStrs []string) (renderer.Environment, error) {
+				mappings := make([]shadertoy.Mapping, 0, len(mappingStrs))
+				for _, str := range mappingStrs {
+					m, err := shadertoy.ParseMapping(str, ".")
+					if err != nil {
+						return nil, err
+					}
+					mappings = append(mappings, m)
+				}
+				env, _, err := newShaderToy(shaders, mappings)
+				if err != nil {
+					return nil, err
+				}
+				return transitionFn(env), nil
+			},
+		}
+		if err := srv.listen(*controlAddr); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// setEnvironment starts setting the environments of the playlist, or of
+	// the -i files on the engine.
+	setEnvironment := func(engine interface{ SetEnvironment(renderer.Environment) }) {
+		if pl != nil {
+			player := &playlist.Player{
+				Playlist:       pl,
+				Engine:         engine,
+				NewEnvironment: newEntryFn,
+				GLSLVersion:    *glslVersion,
+				Verbose:        *verbose,
+			}
+			go player.Play(ctx)
+		} else if *watch {
+			go watchEnvironment(ctx, engine, newFn, transitionFn)
 		} else {
 			env, _, err := newFn()
 			if err != nil {
@@ -171,8 +377,71 @@ func main() {
 			}
 			engine.SetEnvironment(env)
 		}
+	}
 
-		if err := engine.Animate(ctx); errors.Is(err, renderer.ErrWindowClosed) {
+	// Check whether we should render directly to an onscreen window. This is a
+	// separate rendering path.
+	if outputs[0].formatName == "x11" {
+		windowOpts := renderer.WindowOptions{
+			Fullscreen: *fullscreen,
+			Monitor:    *monitor,
+			Borderless: *borderless,
+			VSync:      *vsync,
+		}
+		var err error
+		windowOpts.Width, windowOpts.Height, windowOpts.X, windowOpts.Y, windowOpts.Positioned, err = parseWindowGeometry(*windowGeometry)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *renderScale <= 0 {
+			log.Fatalf("-render-scale must be positive, got %g", *renderScale)
+		}
+		windowOpts.RenderScale = *renderScale
+		if windowOpts.Filter, err = renderer.ParseScaleFilter(*scaleFilterStr); err != nil {
+			log.Fatal(err)
+		}
+		if *renderSize != "" {
+			if windowOpts.RenderWidth, windowOpts.RenderHeight, err = parseGeometry(*renderSize); err != nil {
+				log.Fatal(err)
+			}
+		} else if isFlagSet("g") {
+			// Show exactly what a display of this geometry will show.
+			if windowOpts.RenderWidth, windowOpts.RenderHeight, err = parseGeometry(*geometry); err != nil {
+				log.Fatal(err)
+			}
+			if !isFlagSet("filter") {
+				windowOpts.Filter = renderer.ScaleInteger
+			}
+		}
+		engine, err := renderer.NewOnScreenEngine(openGLVersion, windowOpts)
+		if err != nil {
+			log.Fatalf("Couldn't initialize engine: %v", err)
+		}
+		defer engine.Close()
+		engine.SetClock(startTime, epoch)
+		recordFormat, ok := encode.Formats[*recordFormatName]
+		if !ok {
+			log.Fatalf("Unknown recording format: %q", *recordFormatName)
+		}
+		capture := &windowCapture{
+			format: configureFormat(recordFormat, "", formatOptions{
+				gifPalette: *gifPalette,
+				gifDither:  *gifDither,
+				ffmpegArgs: *ffmpegArgs,
+			}, newFn),
+		}
+		engine.OnScreenshot = capture.screenshot
+		engine.OnRecord = capture.record
+		if *verbose {
+			log.Printf("Keyboard controls:\n%s", renderer.OnScreenKeys)
+		}
+
+		startControl(engine)
+		setEnvironment(engine)
+
+		err = engine.Animate(ctx)
+		capture.wait()
+		if errors.Is(err, renderer.ErrWindowClosed) {
 			return
 		} else if err != nil {
 			log.Fatal(err)
@@ -186,29 +455,60 @@ func main() {
 		log.Fatalf("%v", err)
 	}
 
-	engine, err := renderer.NewShader(width, height, openGLVersion)
-	if err != nil {
-		log.Fatalf("Couldn't initialize engine: %v", err)
+	for _, o := range outputs {
+		o.format = configureFormat(o.format, o.name, formatOptions{
+			gifPalette:      *gifPalette,
+			gifDither:       *gifDither,
+			ffmpegArgs:      *ffmpegArgs,
+			soundtrackFile:  *soundtrackFile,
+			soundtrackStart: startTime,
+			exrCompression:  *exrCompression,
+			seqStart:        *seqStart,
+			seqWorkers:      *seqWorkers,
+			seqSkipExisting: *seqSkipExisting,
+		}, newFn)
 	}
-	defer engine.Close()
 
-	var format encode.Format
-	var ok bool
-	if format, ok = encode.Formats[*outputFormat]; !ok {
-		if format, ok = encode.DetectFormat(*outputFile); !ok {
-			log.Fatalf("Unable to detect output format. Please set the -ofmt flag")
+	pixelFormat := renderer.RGBA8
+	if *pixelFormatStr == "auto" {
+		// 8 bit outputs can handle floating point images, so one HDR output
+		// is enough to render with floats.
+		for _, o := range outputs {
+			if hf, ok := o.format.(encode.HDRFormat); ok && hf.IsHDR() {
+				pixelFormat = renderer.RGBA32F
+			}
 		}
+	} else if pixelFormat, err = renderer.ParsePixelFormat(*pixelFormatStr); err != nil {
+		log.Fatal(err)
+	}
+	if *verbose {
+		log.Printf("Pixel format: %s", pixelFormat)
 	}
 
-	// Open the output.
-	outWriter, err := openWriter(*outputFile)
+	engine, err := renderer.NewShaderWithOptions(width, height, renderer.ShaderOptions{
+		PixelFormat: pixelFormat,
+		TileSize:    *tileSize,
+		Supersample: *supersample,
+	}, openGLVersion)
 	if err != nil {
-		log.Fatalf("%v", err)
+		log.Fatalf("Couldn't initialize engine: %v", err)
+	}
+	defer engine.Close()
+	engine.SetClock(clockStart, epoch)
+
+	// Open the outputs.
+	for _, o := range outputs {
+		if o.writer, err = openWriter(o.format, o.name); err != nil {
+			log.Fatalf("%v", err)
+		}
+		defer o.writer.Close()
 	}
-	defer outWriter.Close()
 
 	in := make(chan image.Image, 10)
 	out := (<-chan image.Image)(in)
+	if prerollFrames > 0 {
+		out = skipFrames(out, prerollFrames)
+	}
 	if animateNumFrames > 0 {
 		out = limitNumFrames(out, animateNumFrames)
 	}
@@ -219,26 +519,18 @@ func main() {
 		out = printStats(out, interval, animateNumFrames)
 	}
 	go func() {
-		if err := format.EncodeAnimation(outWriter, out, interval); err != nil {
-			log.Printf("Error animating: %v", err)
-		}
+		runOutputs(out, outputs, interval)
 		cancel()
 	}()
 
-	if *watch {
-		go watchEnvironment(ctx, engine, newFn)
-	} else {
-		env, _, err := newFn()
-		if err != nil {
-			log.Fatal(err)
-		}
-		engine.SetEnvironment(env)
-	}
+	startControl(engine)
+	setEnvironment(engine)
 
 	engine.Animate(ctx, interval, in)
 }
 
-func watchEnvironment(ctx context.Context, engine interface{ SetEnvironment(renderer.Environment) }, newFn func() (renderer.Environment, []string, error)) {
+func watchEnvironment(ctx context.Context, engine interface{ SetEnvironment(renderer.Environment) }, newFn func() (renderer.Environment, []string, error), transitionFn func(renderer.Environment) renderer.Environment) {
+	first := true
 	for ctx.Err() == nil {
 		loopCtx, loopCancel := context.WithCancel(ctx)
 
@@ -268,7 +560,12 @@ func watchEnvironment(ctx context.Context, engine interface{ SetEnvironment(rend
 			continue
 		}
 
-		// Load the new environment.
+		// Load the new environment. The engine transitions from the
+		// previous environment, if there is one.
+		if !first {
+			env = transitionFn(env)
+		}
+		first = false
 		engine.SetEnvironment(env)
 
 		select {
@@ -292,6 +589,24 @@ func watchEnvironment(ctx context.Context, engine interface{ SetEnvironment(rend
 	}
 }
 
+// soundtrack returns the file of the first audio mapping of the environment
+// that refers to a regular audio file.
+func soundtrack(env renderer.Environment) string {
+	st, ok := env.(*shadertoy.ShaderToy)
+	if !ok {
+		return ""
+	}
+	for _, m := range st.Mappings() {
+		if m.Namespace != "audio" || strings.Contains(m.Value, ";") {
+			continue
+		}
+		if path, err := shadertoy.ResolvePath(m.PWD, m.Value); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
 func limitNumFrames(in <-chan image.Image, desiredTotalNumFrames uint) <-chan image.Image {
 	out := make(chan image.Image)
 	go func() {
@@ -308,6 +623,22 @@ func limitNumFrames(in <-chan image.Image, desiredTotalNumFrames uint) <-chan im
 	return out
 }
 
+// skipFrames discards the first frames of the stream.
+func skipFrames(in <-chan image.Image, numFrames uint) <-chan image.Image {
+	out := make(chan image.Image)
+	go func() {
+		defer close(out)
+		frame := uint(0)
+		for img := range in {
+			frame++
+			if frame > numFrames {
+				out <- img
+			}
+		}
+	}()
+	return out
+}
+
 func limitFramerate(in <-chan image.Image, interval time.Duration) <-chan image.Image {
 	if interval == 0 {
 		return in
@@ -373,7 +704,81 @@ func parseGeometry(geom string) (uint, uint, error) {
 	return uint(w), uint(h), nil
 }
 
-func openWriter(filename string) (io.WriteCloser, error) {
+// parseWindowGeometry parses a window geometry in WIDTHxHEIGHT[+X+Y] format,
+// like the -geometry option of X programs. The position may be negative.
+func parseWindowGeometry(geom string) (w, h, x, y int, positioned bool, err error) {
+	re := regexp.MustCompile(`^(\d+)x(\d+)(?:([+-]\d+)([+-]\d+))?$`)
+	matches := re.FindStringSubmatch(geom)
+	if matches == nil {
+		return 0, 0, 0, 0, false, fmt.Errorf("invalid window geometry: %q", geom)
+	}
+	w, _ = strconv.Atoi(matches[1])
+	h, _ = strconv.Atoi(matches[2])
+	if w == 0 || h == 0 {
+		return 0, 0, 0, 0, false, fmt.Errorf("no window dimension can be 0, got (%d, %d)", w, h)
+	}
+	if matches[3] != "" {
+		x, _ = strconv.Atoi(matches[3])
+		y, _ = strconv.Atoi(matches[4])
+		positioned = true
+	}
+	return w, h, x, y, positioned, nil
+}
+
+// formatOptions are the flags that configure specific formats.
+type formatOptions struct {
+	gifPalette      string
+	gifDither       string
+	ffmpegArgs      string
+	soundtrackFile  string
+	soundtrackStart time.Duration
+	exrCompression  string
+	seqStart        int
+	seqWorkers      int
+	seqSkipExisting bool
+}
+
+// configureFormat applies the options to the format of an output. Outputs
+// with a frame number verb in their name are wrapped in a SequenceFormat.
+func configureFormat(format encode.Format, name string, opts formatOptions, newFn func() (renderer.Environment, []string, error)) encode.Format {
+	if gf, ok := format.(encode.GIFFormat); ok {
+		gf.Palette = opts.gifPalette
+		gf.Dither = opts.gifDither
+		format = gf
+	}
+	if ff, ok := format.(encode.FFmpegFormat); ok {
+		ff.Args = strings.Fields(opts.ffmpegArgs)
+		ff.Audio = opts.soundtrackFile
+		ff.AudioStart = opts.soundtrackStart
+		if ff.Audio == "mapping" {
+			ff.Audio = ""
+			if env, _, err := newFn(); err == nil {
+				ff.Audio = soundtrack(env)
+				env.Close()
+			}
+		}
+		format = ff
+	}
+	if ef, ok := format.(encode.EXRFormat); ok {
+		ef.Compression = opts.exrCompression
+		format = ef
+	}
+	if encode.IsSequencePattern(name) {
+		format = encode.SequenceFormat{
+			Pattern:      name,
+			Format:       format,
+			Start:        opts.seqStart,
+			Workers:      opts.seqWorkers,
+			SkipExisting: opts.seqSkipExisting,
+		}
+	}
+	return format
+}
+
+func openWriter(format encode.Format, filename string) (io.WriteCloser, error) {
+	if opener, ok := format.(encode.Opener); ok {
+		return opener.Open(filename)
+	}
 	if filename == "-" {
 		return nopCloseWriter{Writer: os.Stdout}, nil
 	}
@@ -388,6 +793,16 @@ func (nopCloseWriter) Close() error {
 	return nil
 }
 
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
 type arrayFlags []string
 
 func (i *arrayFlags) String() string {
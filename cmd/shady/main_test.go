@@ -49,3 +49,42 @@ func TestParseGeometry(t *testing.T) {
 		}
 	})
 }
+
+func TestParseWindowGeometry(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		valid := map[string]struct {
+			w, h, x, y int
+			positioned bool
+		}{
+			"800x600":          {w: 800, h: 600},
+			"800x600+10+20":    {w: 800, h: 600, x: 10, y: 20, positioned: true},
+			"1920x1080-1920+0": {w: 1920, h: 1080, x: -1920, y: 0, positioned: true},
+		}
+
+		for input, expected := range valid {
+			w, h, x, y, positioned, err := parseWindowGeometry(input)
+			if err != nil {
+				t.Errorf("error parsing valid window geometry %q: %v", input, err)
+			}
+			if w != expected.w || h != expected.h || x != expected.x || y != expected.y || positioned != expected.positioned {
+				t.Errorf("mismatched result for %q: (%d, %d, %d, %d, %v)", input, w, h, x, y, positioned)
+			}
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		invalid := []string{
+			"0x600",
+			"800x600+10",
+			"800x600+x+y",
+			"+10+20",
+			"",
+		}
+
+		for _, input := range invalid {
+			if _, _, _, _, _, err := parseWindowGeometry(input); err == nil {
+				t.Errorf("expected an error while parsing invalid window geometry %q", input)
+			}
+		}
+	})
+}
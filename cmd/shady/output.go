@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/billtraill/shady/encode"
+)
+
+const (
+	// dropBlock never drops frames, rendering waits for the output instead.
+	dropBlock = "block"
+	// dropOldest replaces the oldest buffered frame when the buffer is full.
+	dropOldest = "oldest"
+	// dropNewest discards new frames while the buffer is full.
+	dropNewest = "newest"
+)
+
+var (
+	outputSchemeRe  = regexp.MustCompile(`^([a-z0-9]+)://(.*)$`)
+	outputOptionsRe = regexp.MustCompile(`\?((?:(?:buffer|drop)=[^&]*&?)+)$`)
+)
+
+// An output is one of the destinations specified with -o.
+type output struct {
+	// name is the value of the -o flag without the format and options. It is
+	// passed to the format as the file or address to open.
+	name string
+	// formatName is the key of the format in encode.Formats, or "x11".
+	formatName string
+	format     encode.Format
+	// buffer is the number of frames that can be queued for the output.
+	buffer int
+	// drop is the policy for frames that arrive while the buffer is full.
+	drop string
+
+	writer  io.WriteCloser
+	frames  chan image.Image
+	done    chan struct{}
+	dropped int
+}
+
+// parseOutput parses the value of an -o flag, which has the form
+// [FORMAT://]NAME[?buffer=N&drop=POLICY].
+//
+// If no format is specified, it is detected from the extension of the name.
+// The format set with -ofmt takes precedence over detection.
+func parseOutput(value, formatFlag string, buffer int, drop string) (*output, error) {
+	o := &output{name: value, buffer: buffer, drop: drop}
+	if match := outputOptionsRe.FindStringSubmatch(o.name); match != nil {
+		o.name = o.name[:len(o.name)-len(match[0])]
+		query, err := url.ParseQuery(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid options for output %q: %w", value, err)
+		}
+		if v := query.Get("buffer"); v != "" {
+			if o.buffer, err = strconv.Atoi(v); err != nil || o.buffer < 0 {
+				return nil, fmt.Errorf("invalid buffer size for output %q: %q", value, v)
+			}
+		}
+		if v := query.Get("drop"); v != "" {
+			o.drop = v
+		}
+	}
+	switch o.drop {
+	case dropBlock:
+	case dropOldest, dropNewest:
+		// Frames can only be dropped from a buffer.
+		if o.buffer == 0 {
+			o.buffer = 1
+		}
+	default:
+		return nil, fmt.Errorf("invalid drop policy for output %q: %q", value, o.drop)
+	}
+
+	if match := outputSchemeRe.FindStringSubmatch(o.name); match != nil {
+		if _, ok := encode.Formats[match[1]]; !ok && match[1] != "x11" {
+			return nil, fmt.Errorf("unknown format for output %q: %q", value, match[1])
+		}
+		o.formatName, o.name = match[1], match[2]
+		if o.name == "" {
+			o.name = "-"
+		}
+	} else if formatFlag != "" {
+		o.formatName = formatFlag
+	} else if detected, ok := encode.DetectFormat(o.name); ok {
+		o.formatName, o.format = strings.TrimPrefix(path.Ext(o.name), "."), detected
+	} else {
+		return nil, fmt.Errorf("unable to detect the format of output %q. Please set the -ofmt flag or use FORMAT://%s", value, value)
+	}
+	if o.format == nil && o.formatName != "x11" {
+		var ok bool
+		if o.format, ok = encode.Formats[o.formatName]; !ok {
+			return nil, fmt.Errorf("unknown format for output %q: %q", value, o.formatName)
+		}
+	}
+	return o, nil
+}
+
+func (o *output) String() string {
+	if o.name == "-" {
+		return o.formatName
+	}
+	return o.formatName + "://" + o.name
+}
+
+// runOutputs encodes the stream to all outputs concurrently. Every output has
+// its own buffer and drop policy, so a slow output only holds back the others
+// if its policy is to block. An output that fails is reported and no longer
+// receives frames while the others continue.
+//
+// runOutputs returns when the stream is closed or when all outputs have
+// stopped.
+func runOutputs(stream <-chan image.Image, outputs []*output, interval time.Duration) {
+	var wg sync.WaitGroup
+	for _, o := range outputs {
+		o.frames = make(chan image.Image, o.buffer)
+		o.done = make(chan struct{})
+		wg.Add(1)
+		go func(o *output) {
+			defer wg.Done()
+			if err := o.format.EncodeAnimation(o.writer, o.frames, interval); err != nil {
+				log.Printf("Error in output %s: %v", o, err)
+			}
+			close(o.done)
+		}(o)
+	}
+
+	for img := range stream {
+		numActive := 0
+		for _, o := range outputs {
+			if o.send(img) {
+				numActive++
+			}
+		}
+		if numActive == 0 {
+			break
+		}
+	}
+	for _, o := range outputs {
+		close(o.frames)
+	}
+	wg.Wait()
+	for _, o := range outputs {
+		if o.dropped > 0 {
+			log.Printf("Output %s dropped %d frames", o, o.dropped)
+		}
+	}
+}
+
+// send queues a frame according to the drop policy of the output. It reports
+// whether the output is still accepting frames.
+func (o *output) send(img image.Image) bool {
+	select {
+	case <-o.done:
+		return false
+	default:
+	}
+	switch o.drop {
+	case dropNewest:
+		select {
+		case o.frames <- img:
+		default:
+			o.dropped++
+		}
+	case dropOldest:
+		for {
+			select {
+			case o.frames <- img:
+				return true
+			default:
+			}
+			select {
+			case <-o.frames:
+				o.dropped++
+			default:
+			}
+		}
+	default:
+		select {
+		case o.frames <- img:
+		case <-o.done:
+			return false
+		}
+	}
+	return true
+}
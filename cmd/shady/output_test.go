@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestParseOutput(t *testing.T) {
+	valid := map[string]struct {
+		formatFlag string
+		name       string
+		formatName string
+		buffer     int
+		drop       string
+	}{
+		"out.mp4":                      {name: "out.mp4", formatName: "mp4", buffer: 10, drop: dropBlock},
+		"http://:8080":                 {name: ":8080", formatName: "http", buffer: 10, drop: dropBlock},
+		"tpm2:///dev/ttyACM0":          {name: "/dev/ttyACM0", formatName: "tpm2", buffer: 10, drop: dropBlock},
+		"-":                            {formatFlag: "rgb24", name: "-", formatName: "rgb24", buffer: 10, drop: dropBlock},
+		"ansi://":                      {name: "-", formatName: "ansi", buffer: 10, drop: dropBlock},
+		"out.gif?drop=oldest":          {name: "out.gif", formatName: "gif", buffer: 10, drop: dropOldest},
+		"out.png?buffer=0&drop=newest": {name: "out.png", formatName: "png", buffer: 1, drop: dropNewest},
+	}
+	for value, expected := range valid {
+		o, err := parseOutput(value, expected.formatFlag, 10, dropBlock)
+		if err != nil {
+			t.Errorf("error parsing valid output %q: %v", value, err)
+			continue
+		}
+		if o.name != expected.name || o.formatName != expected.formatName || o.buffer != expected.buffer || o.drop != expected.drop {
+			t.Errorf("mismatched result for %q: %+v", value, o)
+		}
+		if o.format == nil {
+			t.Errorf("no format for %q", value)
+		}
+	}
+
+	invalid := []string{
+		"out.unknown",
+		"opc://localhost:7890",
+		"out.mp4?drop=sometimes",
+		"out.mp4?buffer=-1",
+	}
+	for _, value := range invalid {
+		if _, err := parseOutput(value, "", 10, dropBlock); err == nil {
+			t.Errorf("expected an error while parsing invalid output %q", value)
+		}
+	}
+}
+
+type testFormat struct {
+	delay    time.Duration
+	err      error
+	received int
+}
+
+func (f *testFormat) Extensions() []string {
+	return []string{}
+}
+
+func (f *testFormat) Encode(w io.Writer, img image.Image) error {
+	return nil
+}
+
+func (f *testFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	for range stream {
+		if f.err != nil {
+			return f.err
+		}
+		time.Sleep(f.delay)
+		f.received++
+	}
+	return nil
+}
+
+func TestRunOutputs(t *testing.T) {
+	fast := &testFormat{}
+	slow := &testFormat{delay: time.Millisecond * 20}
+	failing := &testFormat{err: errors.New("oops")}
+	outputs := []*output{
+		{name: "fast", format: fast, buffer: 1, drop: dropBlock},
+		{name: "slow", format: slow, buffer: 1, drop: dropNewest},
+		{name: "failing", format: failing, buffer: 1, drop: dropBlock},
+	}
+	stream := make(chan image.Image)
+	go func() {
+		defer close(stream)
+		for i := 0; i < 50; i++ {
+			stream <- image.NewRGBA(image.Rect(0, 0, 1, 1))
+		}
+	}()
+	runOutputs(stream, outputs, 0)
+
+	if fast.received != 50 {
+		t.Errorf("the blocking output should receive all frames, got %d", fast.received)
+	}
+	if slow.received+outputs[1].dropped != 50 || outputs[1].dropped == 0 {
+		t.Errorf("the slow output should drop frames, got %d and dropped %d", slow.received, outputs[1].dropped)
+	}
+}
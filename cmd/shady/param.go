@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/billtraill/shady/playlist"
+	"github.com/billtraill/shady/shadertoy"
+)
+
+// paramValues are the values of parameters that are set with -preset and
+// -param. They apply to every shader that declares the parameters.
+type paramValues struct {
+	// presetFile is the file of -preset, which current values are saved to.
+	presetFile string
+	// flags are the values of -param, which override the preset.
+	flags map[string][]float32
+
+	lock   sync.Mutex
+	preset map[string][]float32
+}
+
+// parseParamFlag parses the value of -param, e.g. "speed=2.5" or
+// "color=1,0.5,0".
+func parseParamFlag(str string) (string, []float32, error) {
+	parts := strings.SplitN(str, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", nil, fmt.Errorf("unable to parse parameter from %q, expected NAME=VALUE", str)
+	}
+	values, err := shadertoy.ParseParamValues(strings.Split(parts[1], ","))
+	if err != nil {
+		return "", nil, fmt.Errorf("parameter %s: %w", parts[0], err)
+	}
+	return parts[0], values, nil
+}
+
+// loadPreset reads the values of parameters from a JSON file, e.g.
+// {"speed": 2.5, "invert": true, "color": [1, 0.5, 0]}.
+func loadPreset(filename string) (map[string][]float32, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var preset map[string]playlist.Values
+	if err := json.Unmarshal(data, &preset); err != nil {
+		return nil, fmt.Errorf("unable to parse preset %s: %w", filename, err)
+	}
+	values := make(map[string][]float32, len(preset))
+	for name, v := range preset {
+		values[name] = v
+	}
+	return values, nil
+}
+
+// presetJSON returns the values of parameters in the format of a preset file.
+func presetJSON(values map[string][]float32) ([]byte, error) {
+	preset := make(map[string]interface{}, len(values))
+	for name, v := range values {
+		if len(v) == 1 {
+			preset[name] = v[0]
+		} else {
+			preset[name] = v
+		}
+	}
+	return json.MarshalIndent(preset, "", "  ")
+}
+
+// apply sets the parameters that the environment declares.
+func (pv *paramValues) apply(env *shadertoy.ShaderToy) error {
+	pv.lock.Lock()
+	defer pv.lock.Unlock()
+	for _, p := range env.Params() {
+		values, ok := pv.flags[p.Name]
+		if !ok {
+			values, ok = pv.preset[p.Name]
+		}
+		if !ok {
+			continue
+		}
+		if err := env.SetParam(p.Name, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save merges the values of parameters into the preset, which is written to
+// the preset file and applied to shaders that are loaded later.
+func (pv *paramValues) save(values map[string][]float32) error {
+	if pv.presetFile == "" {
+		return fmt.Errorf("no preset file is set with -preset")
+	}
+	pv.lock.Lock()
+	defer pv.lock.Unlock()
+	preset := make(map[string][]float32, len(pv.preset)+len(values))
+	for name, v := range pv.preset {
+		preset[name] = v
+	}
+	for name, v := range values {
+		preset[name] = v
+	}
+	data, err := presetJSON(preset)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(pv.presetFile, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	pv.preset = preset
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseParamFlag(t *testing.T) {
+	valid := map[string]struct {
+		name   string
+		values []float32
+	}{
+		"speed=2.5":     {"speed", []float32{2.5}},
+		"color=1,0.5,0": {"color", []float32{1, 0.5, 0}},
+		"invert=true":   {"invert", []float32{1}},
+		"pos=-1, 2":     {"pos", []float32{-1, 2}},
+		"expr=1e3":      {"expr", []float32{1000}},
+	}
+	for str, expected := range valid {
+		name, values, err := parseParamFlag(str)
+		if err != nil {
+			t.Errorf("error parsing valid parameter %q: %v", str, err)
+			continue
+		}
+		if name != expected.name || !reflect.DeepEqual(values, expected.values) {
+			t.Errorf("mismatched result for %q: %s=%v", str, name, values)
+		}
+	}
+	for _, str := range []string{"speed", "=2.5", "speed=", "speed=fast", "color=1,,0"} {
+		if _, _, err := parseParamFlag(str); err == nil {
+			t.Errorf("expected an error for %q", str)
+		}
+	}
+}
+
+func TestPreset(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "preset.json")
+	pv := &paramValues{
+		presetFile: filename,
+		preset:     map[string][]float32{"other": {1}},
+	}
+	if err := pv.save(map[string][]float32{"speed": {2.5}, "color": {1, 0.5, 0}}); err != nil {
+		t.Fatal(err)
+	}
+	preset, err := loadPreset(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]float32{"other": {1}, "speed": {2.5}, "color": {1, 0.5, 0}}
+	if !reflect.DeepEqual(preset, expected) || !reflect.DeepEqual(pv.preset, expected) {
+		t.Errorf("unexpected preset: %v, %v", preset, pv.preset)
+	}
+
+	if err := (&paramValues{}).save(expected); err == nil {
+		t.Errorf("expected an error without a preset file")
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"time"
+
+	"github.com/billtraill/shady/encode"
+)
+
+// play implements the "shady play" command, which sends the frames of a
+// recording to outputs in real time, without rendering anything. Recordings
+// can be in the framed, rgb24 or rgba32 formats, GIFs or image sequences and
+// may be compressed with gzip.
+func play(args []string) {
+	fs := flag.NewFlagSet("play", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: shady play [flags] FILE\n")
+		fs.PrintDefaults()
+	}
+	var outputFiles arrayFlags
+	fs.Var(&outputFiles, "o", "The output to play to, \"-\" by default. May be repeated, see shady -help")
+	outputFormat := fs.String("ofmt", "", "The encoding format to use for outputs of which the format is not detected")
+	outputBuffer := fs.Int("obuf", 10, "The number of frames that are buffered for each output")
+	outputDrop := fs.String("odrop", dropBlock, "What to do with frames for an output that has a full buffer. Valid values are: block, oldest, newest")
+	inputFormat := fs.String("ifmt", "auto", "The format of the recording. If \"auto\", it is detected from the contents. Valid values are: auto, framed, gif, rgb24, rgba32, sequence")
+	geometry := fs.String("g", "", "The size of the frames of raw recordings in WIDTHxHEIGHT format, or \"env\" to use LEDCAT_GEOMETRY")
+	framerate := fs.Float64("f", 0, "Play at the specified number of frames per second instead of the recorded timing. Recordings without timing play at 30 frames per second by default")
+	loop := fs.Bool("loop", false, "Play the recording repeatedly")
+	seqStart := fs.Int("seq-start", 0, "The number of the first frame of an image sequence")
+	verbose := fs.Bool("v", false, "Show verbose output about playback")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	name := fs.Arg(0)
+	if *loop && name == "-" {
+		log.Fatalf("Can not loop a recording that is read from stdin")
+	}
+
+	opts := sourceOptions{
+		format:   *inputFormat,
+		interval: time.Second / 30,
+		seqStart: *seqStart,
+	}
+	if *geometry != "" {
+		width, height, err := parseGeometry(*geometry)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.width, opts.height = int(width), int(height)
+	}
+	var interval time.Duration
+	if *framerate > 0 {
+		interval = time.Duration(float64(time.Second) / *framerate)
+		opts.interval = interval
+	}
+
+	src, closer, err := openSource(name, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The interval between the first frames is passed to the outputs.
+	var frames []*encode.Frame
+	for len(frames) < 2 {
+		frame, err := src.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Fatal(err)
+		}
+		frames = append(frames, frame)
+	}
+	if len(frames) == 0 {
+		log.Fatalf("%s does not contain any frames", name)
+	}
+	if interval == 0 && len(frames) == 2 {
+		interval = frames[1].PTS - frames[0].PTS
+	}
+	if interval <= 0 {
+		interval = opts.interval
+	}
+
+	if len(outputFiles) == 0 {
+		outputFiles = append(outputFiles, "-")
+	}
+	var outputs []*output
+	for _, value := range outputFiles {
+		o, err := parseOutput(value, *outputFormat, *outputBuffer, *outputDrop)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if o.formatName == "x11" {
+			log.Fatalf("The x11 output is not supported by play")
+		}
+		o.format = configureFormat(o.format, o.name, formatOptions{seqWorkers: runtime.NumCPU()}, nil)
+		if o.writer, err = openWriter(o.format, o.name); err != nil {
+			log.Fatal(err)
+		}
+		defer o.writer.Close()
+		outputs = append(outputs, o)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt)
+		<-sig
+		signal.Stop(sig)
+		cancel()
+	}()
+
+	stream := make(chan image.Image)
+	go func() {
+		defer close(stream)
+		start := time.Now()
+		// The time of a frame in the recording is offset by the duration of
+		// all previous loops.
+		var loopOffset, firstPTS, lastPTS time.Duration
+		for pass := 0; ; pass++ {
+			var index uint64
+			for {
+				var frame *encode.Frame
+				var err error
+				if len(frames) > 0 {
+					frame, frames = frames[0], frames[1:]
+				} else if frame, err = src.Next(); err == io.EOF {
+					break
+				} else if err != nil {
+					log.Printf("Error reading %s: %v", name, err)
+					break
+				}
+				if index == 0 {
+					firstPTS = frame.PTS
+				}
+				pts := frame.PTS - firstPTS
+				if *framerate > 0 {
+					pts = time.Duration(index) * interval
+				}
+				index++
+				lastPTS = pts
+
+				select {
+				case <-time.After(time.Until(start.Add(loopOffset + pts))):
+				case <-ctx.Done():
+					return
+				}
+				if *verbose {
+					fmt.Fprintf(os.Stderr, "\rloop=%d frame=%d time=%v", pass, frame.Index, pts)
+				}
+				select {
+				case stream <- frame.Image:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if fr, ok := src.(*encode.FramedReader); ok && fr.Skipped > 0 {
+				log.Printf("Skipped %d bytes of invalid data", fr.Skipped)
+			}
+			if closer != nil {
+				closer.Close()
+			}
+			if !*loop || index == 0 {
+				return
+			}
+			loopOffset += lastPTS + interval
+			var err error
+			if src, closer, err = openSource(name, opts); err != nil {
+				log.Printf("Error reopening %s: %v", name, err)
+				return
+			}
+		}
+	}()
+	runOutputs(stream, outputs, interval)
+}
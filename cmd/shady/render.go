@@ -0,0 +1,411 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/billtraill/shady/encode"
+	"github.com/billtraill/shady/renderer"
+	"github.com/billtraill/shady/shadertoy"
+)
+
+// render implements the "shady render" command, which splits a range of
+// frames into chunks that are rendered by separate shady processes. Chunks are
+// written to an image sequence directly, or to framed segments which are
+// concatenated into the output when all chunks are done.
+//
+// Instead of running the processes, the commands can be written to a job file
+// so they can be distributed over multiple machines.
+func render(args []string) {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: shady render [flags] [-- shady flags]\n")
+		fmt.Fprintf(fs.Output(), "       shady render -concat -o OUTPUT -f FPS SEGMENT...\n")
+		fs.PrintDefaults()
+	}
+	var inputFiles arrayFlags
+	fs.Var(&inputFiles, "i", "The shader file(s) to use")
+	var shadertoyMappings arrayFlags
+	fs.Var(&shadertoyMappings, "map", "Specify or override ShaderToy input mappings")
+	geometry := fs.String("g", "env", "The geometry of the rendered image in WIDTHxHEIGHT format")
+	framerate := fs.Float64("f", 0, "The number of frames per second")
+	from := fs.Uint("from", 0, "The number of the first frame to render. When concatenating, the soundtrack starts at this frame")
+	numFrames := fs.Uint("n", 0, "The number of frames to render")
+	workers := fs.Int("workers", 2, "The number of chunks to render at the same time")
+	chunkSize := fs.Uint("chunk", 0, "The number of frames in each chunk. By default, the frames are divided evenly over the workers")
+	preroll := fs.Uint("preroll", 0, "The number of frames each chunk renders before its first frame. Required for shaders that use the previous frame or buffers")
+	date := fs.String("date", "", "The date at animation time zero in RFC 3339 format. The current date is used by default, so all chunks see the same date")
+	outputFile := fs.String("o", "", "The file to write the frames to. A frame number verb like frame_%05d.png writes each chunk directly to the sequence")
+	outputFormat := fs.String("ofmt", "", "The encoding format of the output if it can not be detected from its extension")
+	ffmpegArgs := fs.String("ffmpeg-args", "", "Additional output arguments for FFmpeg when encoding video")
+	soundtrackFile := fs.String("soundtrack", "mapping", "The audio file to add to encoded video. If \"mapping\", the file of the first audio mapping is used")
+	jobFile := fs.String("job", "", "Write the commands to render each chunk and concatenate the segments to the specified file instead of running them")
+	concat := fs.Bool("concat", false, "Concatenate the framed segments given as arguments into the output")
+	verbose := fs.Bool("v", false, "Show verbose output about rendering")
+	fs.Parse(args)
+
+	if *outputFile == "" {
+		log.Fatalf("Please specify the output with -o")
+	}
+	if *framerate <= 0 {
+		log.Fatalf("Please specify the frame rate with -f")
+	}
+	interval := time.Duration(float64(time.Second) / *framerate)
+	opts := formatOptions{
+		ffmpegArgs:      *ffmpegArgs,
+		soundtrackFile:  *soundtrackFile,
+		soundtrackStart: time.Duration(*from) * interval,
+		seqWorkers:      runtime.NumCPU(),
+	}
+
+	if *concat {
+		if *soundtrackFile == "mapping" {
+			opts.soundtrackFile = ""
+		}
+		if err := concatSegments(fs.Args(), *outputFile, *outputFormat, opts, interval); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(inputFiles) == 0 {
+		log.Fatalf("Please specify at least one GLSL file with -i")
+	}
+	if *numFrames == 0 {
+		log.Fatalf("Please specify the number of frames with -n")
+	}
+	if *workers < 1 {
+		log.Fatalf("-workers must be at least 1")
+	}
+	if *chunkSize == 0 {
+		*chunkSize = (*numFrames + uint(*workers) - 1) / uint(*workers)
+	}
+	chunks := planChunks(*from, *numFrames, *chunkSize)
+
+	sources, err := renderer.Includes([]string(inputFiles)...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mappings := make([]shadertoy.Mapping, 0, len(shadertoyMappings))
+	for _, str := range shadertoyMappings {
+		m, err := shadertoy.ParseMapping(str, ".")
+		if err != nil {
+			log.Fatal(err)
+		}
+		mappings = append(mappings, m)
+	}
+	env, err := shadertoy.NewShaderToy(renderer.SourceFiles(sources...), mappings, "330")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if usesHistory(env) && *preroll == 0 && (len(chunks) > 1 || *from > 0) {
+		log.Fatalf("The shader uses the previous frame or buffers, so frames depend on the frames before them. Use -preroll to render frames before each chunk")
+	}
+	if opts.soundtrackFile == "mapping" {
+		opts.soundtrackFile = soundtrack(env)
+	}
+
+	if *date == "" {
+		*date = time.Now().UTC().Format(time.RFC3339)
+	}
+	job := renderJob{
+		shady:      os.Args[0],
+		inputFiles: inputFiles,
+		mappings:   shadertoyMappings,
+		geometry:   *geometry,
+		framerate:  *framerate,
+		preroll:    *preroll,
+		date:       *date,
+		extraArgs:  fs.Args(),
+		verbose:    *verbose,
+	}
+
+	sequence := encode.IsSequencePattern(*outputFile)
+	var segments []string
+	var segmentDir string
+	if !sequence {
+		if *jobFile != "" {
+			segmentDir = *outputFile + ".segments"
+			err = os.MkdirAll(segmentDir, 0755)
+		} else {
+			segmentDir, err = ioutil.TempDir("", "shady-render")
+			defer os.RemoveAll(segmentDir)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	commands := make([][]string, len(chunks))
+	for i, c := range chunks {
+		if sequence {
+			commands[i] = job.sequenceArgs(c, *outputFile, *outputFormat)
+		} else {
+			segment := filepath.Join(segmentDir, fmt.Sprintf("segment_%05d.bin", i))
+			segments = append(segments, segment)
+			commands[i] = job.segmentArgs(c, segment)
+		}
+	}
+	var concatCommand []string
+	if !sequence {
+		concatCommand = []string{job.shady, "render", "-concat", "-o", *outputFile, "-f", strconv.FormatFloat(*framerate, 'g', -1, 64)}
+		if *from > 0 {
+			concatCommand = append(concatCommand, "-from", strconv.FormatUint(uint64(*from), 10))
+		}
+		if *outputFormat != "" {
+			concatCommand = append(concatCommand, "-ofmt", *outputFormat)
+		}
+		if *ffmpegArgs != "" {
+			concatCommand = append(concatCommand, "-ffmpeg-args", *ffmpegArgs)
+		}
+		if opts.soundtrackFile != "" {
+			concatCommand = append(concatCommand, "-soundtrack", opts.soundtrackFile)
+		}
+		concatCommand = append(concatCommand, segments...)
+	}
+
+	if *jobFile != "" {
+		if err := writeJobFile(*jobFile, commands, concatCommand); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := runChunks(commands, chunks, *workers, *verbose); err != nil {
+		log.Fatal(err)
+	}
+	if !sequence {
+		if err := concatSegments(segments, *outputFile, *outputFormat, opts, interval); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// A renderChunk is a range of frames that is rendered by a single process.
+type renderChunk struct {
+	start, frames uint
+}
+
+// planChunks divides numFrames frames starting at from into chunks of at most
+// size frames.
+func planChunks(from, numFrames, size uint) []renderChunk {
+	var chunks []renderChunk
+	for start := from; start < from+numFrames; start += size {
+		frames := size
+		if start+frames > from+numFrames {
+			frames = from + numFrames - start
+		}
+		chunks = append(chunks, renderChunk{start: start, frames: frames})
+	}
+	return chunks
+}
+
+// usesHistory reports whether frames rendered by the environment depend on
+// the frames before them.
+func usesHistory(env *shadertoy.ShaderToy) bool {
+	if env.UsesPreviousFrame() {
+		return true
+	}
+	for _, m := range env.Mappings() {
+		if m.Namespace == "buffer" {
+			return true
+		}
+	}
+	return false
+}
+
+// renderJob holds the arguments that are passed to the shady process of every
+// chunk.
+type renderJob struct {
+	shady      string
+	inputFiles []string
+	mappings   []string
+	geometry   string
+	framerate  float64
+	preroll    uint
+	date       string
+	extraArgs  []string
+	verbose    bool
+}
+
+func (job renderJob) args(c renderChunk) []string {
+	args := []string{job.shady}
+	for _, file := range job.inputFiles {
+		args = append(args, "-i", file)
+	}
+	for _, m := range job.mappings {
+		args = append(args, "-map", m)
+	}
+	args = append(args,
+		"-g", job.geometry,
+		"-f", strconv.FormatFloat(job.framerate, 'g', -1, 64),
+		"-start-frame", strconv.FormatUint(uint64(c.start), 10),
+		"-n", strconv.FormatUint(uint64(c.frames), 10),
+		"-date", job.date,
+	)
+	if job.preroll > 0 {
+		args = append(args, "-preroll", strconv.FormatUint(uint64(job.preroll), 10))
+	}
+	if job.verbose {
+		args = append(args, "-v")
+	}
+	return append(args, job.extraArgs...)
+}
+
+// sequenceArgs returns the command that renders the chunk to its frames of an
+// image sequence.
+func (job renderJob) sequenceArgs(c renderChunk, pattern, format string) []string {
+	args := job.args(c)
+	if format != "" {
+		args = append(args, "-ofmt", format)
+	}
+	return append(args, "-seq-start", strconv.FormatUint(uint64(c.start), 10), "-o", pattern)
+}
+
+// segmentArgs returns the command that renders the chunk to a framed segment.
+func (job renderJob) segmentArgs(c renderChunk, segment string) []string {
+	return append(job.args(c), "-o", "framed://"+segment)
+}
+
+// runChunks runs the commands of the chunks with at most workers at the same
+// time. The first error is returned after all running commands have exited.
+func runChunks(commands [][]string, chunks []renderChunk, workers int, verbose bool) error {
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var firstErr error
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				c := chunks[i]
+				cmd := exec.Command(commands[i][0], commands[i][1:]...)
+				cmd.Stderr = os.Stderr
+				start := time.Now()
+				err := cmd.Run()
+				lock.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("rendering frames %d to %d: %w", c.start, c.start+c.frames-1, err)
+					}
+				} else if verbose {
+					log.Printf("Rendered frames %d to %d in %v", c.start, c.start+c.frames-1, time.Since(start).Round(time.Millisecond))
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	for i := range commands {
+		lock.Lock()
+		failed := firstErr != nil
+		lock.Unlock()
+		if failed {
+			break
+		}
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	return firstErr
+}
+
+// writeJobFile writes a shell script in which each line renders a chunk. The
+// lines may be run in any order and on any machine that shares the files.
+// The concatenation command, if any, must be run after all chunks are done.
+func writeJobFile(filename string, commands [][]string, concatCommand []string) error {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	b.WriteString("# Each line renders a chunk of frames and may run on any machine.\n")
+	for _, cmd := range commands {
+		b.WriteString(shellJoin(cmd) + "\n")
+	}
+	if concatCommand != nil {
+		b.WriteString("# Run when all chunks are done:\n")
+		b.WriteString("# " + shellJoin(concatCommand) + "\n")
+	}
+	return ioutil.WriteFile(filename, []byte(b.String()), 0755)
+}
+
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote quotes an argument for sh if it contains special characters.
+func shellQuote(s string) string {
+	safe := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_./:=,+@%", r)
+	}
+	if s != "" && strings.IndexFunc(s, func(r rune) bool { return !safe(r) }) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// concatSegments writes the frames of the framed segments to the output in
+// order.
+func concatSegments(segments []string, value, formatFlag string, opts formatOptions, interval time.Duration) error {
+	if len(segments) == 0 {
+		return fmt.Errorf("no segments to concatenate")
+	}
+	o, err := parseOutput(value, formatFlag, 10, dropBlock)
+	if err != nil {
+		return err
+	}
+	if o.formatName == "x11" {
+		return fmt.Errorf("the x11 output is not supported by render")
+	}
+	o.format = configureFormat(o.format, o.name, opts, nil)
+	if o.writer, err = openWriter(o.format, o.name); err != nil {
+		return err
+	}
+	defer o.writer.Close()
+
+	stream := make(chan image.Image)
+	var readErr error
+	go func() {
+		defer close(stream)
+		for _, name := range segments {
+			file, err := os.Open(name)
+			if err != nil {
+				readErr = err
+				return
+			}
+			fr := encode.NewFramedReader(file)
+			for {
+				frame, err := fr.Next()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					readErr = fmt.Errorf("%s: %w", name, err)
+					file.Close()
+					return
+				}
+				stream <- frame.Image
+			}
+			file.Close()
+			if fr.Skipped > 0 {
+				readErr = fmt.Errorf("%s: skipped %d bytes of invalid data", name, fr.Skipped)
+				return
+			}
+		}
+	}()
+	runOutputs(stream, []*output{o}, interval)
+	return readErr
+}
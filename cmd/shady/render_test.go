@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/billtraill/shady/encode"
+)
+
+func TestPlanChunks(t *testing.T) {
+	chunks := planChunks(100, 250, 100)
+	expected := []renderChunk{{100, 100}, {200, 100}, {300, 50}}
+	if !reflect.DeepEqual(chunks, expected) {
+		t.Errorf("unexpected chunks: %v", chunks)
+	}
+}
+
+func TestRenderJobArgs(t *testing.T) {
+	job := renderJob{
+		shady:      "shady",
+		inputFiles: []string{"a.glsl"},
+		geometry:   "64x32",
+		framerate:  30,
+		preroll:    10,
+		date:       "2021-06-21T12:00:00Z",
+		extraArgs:  []string{"-ss", "2"},
+	}
+	args := strings.Join(job.sequenceArgs(renderChunk{start: 60, frames: 30}, "frame_%05d.png", ""), " ")
+	exp := "shady -i a.glsl -g 64x32 -f 30 -start-frame 60 -n 30 -date 2021-06-21T12:00:00Z -preroll 10 -ss 2 -seq-start 60 -o frame_%05d.png"
+	if args != exp {
+		t.Errorf("unexpected arguments:\nexp %s\ngot %s", exp, args)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for in, exp := range map[string]string{
+		"frame_%05d.png":    "frame_%05d.png",
+		"-c:v libx264":      "'-c:v libx264'",
+		"it's":              `'it'\''s'`,
+		"":                  "''",
+		"buf=buffer:a.glsl": "buf=buffer:a.glsl",
+	} {
+		if got := shellQuote(in); got != exp {
+			t.Errorf("unexpected quoting of %q: exp %s, got %s", in, exp, got)
+		}
+	}
+}
+
+func TestConcatSegments(t *testing.T) {
+	dir := t.TempDir()
+	var segments []string
+	for i := 0; i < 2; i++ {
+		stream := make(chan image.Image, 2)
+		for j := 0; j < 2; j++ {
+			img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+			img.Pix[0] = byte(i*2 + j)
+			stream <- img
+		}
+		close(stream)
+		var buf bytes.Buffer
+		if err := encode.Formats["framed"].EncodeAnimation(&buf, stream, time.Second); err != nil {
+			t.Fatal(err)
+		}
+		segment := filepath.Join(dir, "segment_"+string('0'+rune(i))+".bin")
+		if err := ioutil.WriteFile(segment, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		segments = append(segments, segment)
+	}
+
+	out := filepath.Join(dir, "out.rgb")
+	if err := concatSegments(segments, out, "rgb24", formatOptions{}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []byte{0, 0, 0, 1, 0, 0, 2, 0, 0, 3, 0, 0}; !bytes.Equal(data, exp) {
+		t.Errorf("unexpected output: %v", data)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+	"os"
+	"time"
+
+	"github.com/billtraill/shady/encode"
+)
+
+// A frameSource produces the frames of a recording for playback.
+type frameSource interface {
+	// Next returns the next frame, or io.EOF at the end of the recording.
+	Next() (*encode.Frame, error)
+}
+
+// sourceOptions describe recordings that do not specify everything
+// themselves.
+type sourceOptions struct {
+	// format is the format of the recording: "auto", "framed", "gif",
+	// "rgb24", "rgba32" or "sequence".
+	format string
+	// width and height are the size of raw frames.
+	width, height int
+	// interval is the time between frames that have no timing information.
+	interval time.Duration
+	// seqStart is the number of the first frame of an image sequence.
+	seqStart int
+}
+
+// openSource opens a recording for playback. Compressed files are detected and
+// decompressed with gzip. If the format is "auto", it is detected from the
+// contents. The returned closer is nil if there is nothing to close.
+func openSource(name string, opts sourceOptions) (frameSource, io.Closer, error) {
+	if opts.format == "sequence" || (opts.format == "auto" && encode.IsSequencePattern(name)) {
+		return &sequenceSource{pattern: name, index: opts.seqStart, interval: opts.interval}, nil, nil
+	}
+
+	var in io.ReadCloser = os.Stdin
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		in = file
+	}
+	r := bufio.NewReader(in)
+	if magic, _ := r.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			in.Close()
+			return nil, nil, err
+		}
+		r = bufio.NewReader(zr)
+	}
+
+	format := opts.format
+	if format == "auto" {
+		magic, _ := r.Peek(len(encode.FramedMagic))
+		switch {
+		case bytes.Equal(magic, []byte(encode.FramedMagic)):
+			format = "framed"
+		case bytes.HasPrefix(magic, []byte("GIF8")):
+			format = "gif"
+		case opts.width > 0 && opts.height > 0:
+			format = "rgb24"
+		default:
+			in.Close()
+			return nil, nil, fmt.Errorf("unable to detect the format of %s, set -ifmt and -g for raw recordings", name)
+		}
+	}
+
+	var src frameSource
+	switch format {
+	case "framed":
+		src = encode.NewFramedReader(r)
+	case "gif":
+		g, err := gif.DecodeAll(r)
+		if err != nil {
+			in.Close()
+			return nil, nil, err
+		}
+		src = newGIFSource(g)
+	case "rgb24", "rgba32":
+		if opts.width <= 0 || opts.height <= 0 {
+			in.Close()
+			return nil, nil, fmt.Errorf("the size of raw frames must be set with -g")
+		}
+		bytesPerPixel := 3
+		if format == "rgba32" {
+			bytesPerPixel = 4
+		}
+		src = &rawSource{
+			r:             r,
+			width:         opts.width,
+			height:        opts.height,
+			bytesPerPixel: bytesPerPixel,
+			interval:      opts.interval,
+		}
+	default:
+		in.Close()
+		return nil, nil, fmt.Errorf("unknown input format: %q", format)
+	}
+	return src, in, nil
+}
+
+// rawSource reads frames of rgb24 or rgba32 recordings.
+type rawSource struct {
+	r             io.Reader
+	width, height int
+	bytesPerPixel int
+	interval      time.Duration
+	index         uint64
+}
+
+func (src *rawSource) Next() (*encode.Frame, error) {
+	pixels := make([]byte, src.width*src.height*src.bytesPerPixel)
+	if _, err := io.ReadFull(src.r, pixels); err == io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("the last frame is incomplete, is the geometry correct?")
+	} else if err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(image.Rect(0, 0, src.width, src.height))
+	if src.bytesPerPixel == 4 {
+		copy(img.Pix, pixels)
+	} else {
+		for i := 0; i < src.width*src.height; i++ {
+			copy(img.Pix[i*4:i*4+3], pixels[i*3:i*3+3])
+			img.Pix[i*4+3] = 0xff
+		}
+	}
+	frame := &encode.Frame{
+		Index: src.index,
+		PTS:   time.Duration(src.index) * src.interval,
+		Image: img,
+	}
+	src.index++
+	return frame, nil
+}
+
+// sequenceSource reads numbered image files until a file does not exist.
+type sequenceSource struct {
+	pattern  string
+	index    int
+	interval time.Duration
+	count    uint64
+}
+
+func (src *sequenceSource) Next() (*encode.Frame, error) {
+	file, err := os.Open(fmt.Sprintf(src.pattern, src.index))
+	if os.IsNotExist(err) {
+		if src.count == 0 {
+			return nil, fmt.Errorf("the first frame of %s does not exist: %w", src.pattern, err)
+		}
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode %s: %w", file.Name(), err)
+	}
+	frame := &encode.Frame{
+		Index: src.count,
+		PTS:   time.Duration(src.count) * src.interval,
+		Image: img,
+	}
+	src.index++
+	src.count++
+	return frame, nil
+}
+
+// gifSource composes the frames of a GIF according to their disposal
+// methods.
+type gifSource struct {
+	g      *gif.GIF
+	canvas *image.RGBA
+	index  int
+	pts    time.Duration
+	// restore is the area of the canvas that must be disposed of before the
+	// next frame is drawn, along with its previous contents if any.
+	restore     image.Rectangle
+	restoreWith *image.RGBA
+}
+
+func newGIFSource(g *gif.GIF) *gifSource {
+	return &gifSource{
+		g:      g,
+		canvas: image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height)),
+	}
+}
+
+func (src *gifSource) Next() (*encode.Frame, error) {
+	if src.index >= len(src.g.Image) {
+		return nil, io.EOF
+	}
+	if src.restoreWith != nil {
+		draw.Draw(src.canvas, src.restore, src.restoreWith, src.restore.Min, draw.Src)
+	} else if !src.restore.Empty() {
+		draw.Draw(src.canvas, src.restore, image.Transparent, image.Point{}, draw.Src)
+	}
+
+	img := src.g.Image[src.index]
+	src.restore, src.restoreWith = image.Rectangle{}, nil
+	if src.index < len(src.g.Disposal) {
+		switch src.g.Disposal[src.index] {
+		case gif.DisposalBackground:
+			src.restore = img.Bounds()
+		case gif.DisposalPrevious:
+			src.restore = img.Bounds()
+			src.restoreWith = image.NewRGBA(src.canvas.Rect)
+			draw.Draw(src.restoreWith, src.restore, src.canvas, src.restore.Min, draw.Src)
+		}
+	}
+	draw.Draw(src.canvas, img.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	frame := &encode.Frame{
+		Index: uint64(src.index),
+		PTS:   src.pts,
+		Image: image.NewRGBA(src.canvas.Rect),
+	}
+	copy(frame.Image.(*image.RGBA).Pix, src.canvas.Pix)
+	if src.index < len(src.g.Delay) {
+		src.pts += time.Duration(src.g.Delay[src.index]) * time.Second / 100
+	}
+	src.index++
+	return frame, nil
+}
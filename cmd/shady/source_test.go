@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/billtraill/shady/encode"
+)
+
+// readSource reads all frames of the recording.
+func readSource(t *testing.T, name string, opts sourceOptions) []*encode.Frame {
+	src, closer, err := openSource(name, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+	var frames []*encode.Frame
+	for {
+		frame, err := src.Next()
+		if err == io.EOF {
+			return frames
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, frame)
+	}
+}
+
+func TestSourceFramedGzip(t *testing.T) {
+	stream := make(chan image.Image, 2)
+	stream <- image.NewRGBA(image.Rect(0, 0, 2, 2))
+	stream <- image.NewRGBA(image.Rect(0, 0, 2, 2))
+	close(stream)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := encode.Formats["framed"].EncodeAnimation(zw, stream, time.Second/10); err != nil {
+		t.Fatal(err)
+	}
+	zw.Close()
+	name := filepath.Join(t.TempDir(), "recording.bin.gz")
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	frames := readSource(t, name, sourceOptions{format: "auto"})
+	if len(frames) != 2 || frames[1].PTS != time.Second/10 {
+		t.Fatalf("unexpected frames: %+v", frames)
+	}
+}
+
+func TestSourceRaw(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "recording.bin")
+	if err := ioutil.WriteFile(name, bytes.Repeat([]byte{1, 2, 3}, 2*1*3), 0644); err != nil {
+		t.Fatal(err)
+	}
+	frames := readSource(t, name, sourceOptions{format: "auto", width: 2, height: 1, interval: time.Second / 5})
+	if len(frames) != 3 || frames[2].PTS != time.Second*2/5 {
+		t.Fatalf("unexpected frames: %+v", frames)
+	}
+	if c := frames[0].Image.At(1, 0); c != (color.RGBA{R: 1, G: 2, B: 3, A: 255}) {
+		t.Errorf("unexpected color: %v", c)
+	}
+}
+
+func TestSourceGIF(t *testing.T) {
+	p := color.Palette{color.Transparent, color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}}
+	full := image.NewPaletted(image.Rect(0, 0, 2, 1), p)
+	full.Pix = []uint8{1, 1}
+	// The second frame only covers the right pixel and is disposed to the
+	// background, so the third frame shows the red left pixel.
+	right := image.NewPaletted(image.Rect(1, 0, 2, 1), p)
+	right.Pix = []uint8{2}
+	none := image.NewPaletted(image.Rect(0, 0, 1, 1), p)
+	none.Pix = []uint8{0}
+	g := &gif.GIF{
+		Image:    []*image.Paletted{full, right, none},
+		Delay:    []int{10, 20, 10},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalNone},
+		Config:   image.Config{Width: 2, Height: 1},
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "animation.gif")
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	frames := readSource(t, name, sourceOptions{format: "auto"})
+	if len(frames) != 3 || frames[2].PTS != time.Millisecond*300 {
+		t.Fatalf("unexpected frames: %+v", frames)
+	}
+	expected := [][2]color.RGBA{
+		{{R: 255, A: 255}, {R: 255, A: 255}},
+		{{R: 255, A: 255}, {B: 255, A: 255}},
+		{{R: 255, A: 255}, {}},
+	}
+	for i, exp := range expected {
+		for x, c := range exp {
+			if got := frames[i].Image.At(x, 0); got != c {
+				t.Errorf("unexpected color of pixel %d in frame %d: exp %v, got %v", x, i, c, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/billtraill/shady/encode"
+)
+
+// windowCapture saves the screenshots and recordings that are requested in
+// the window of the x11 output.
+type windowCapture struct {
+	// format is the format of recordings.
+	format encode.Format
+	wg     sync.WaitGroup
+}
+
+// captureName returns the name of a new capture file with the extension of
+// the format.
+func captureName(format encode.Format) string {
+	ext := "bin"
+	if exts := format.Extensions(); len(exts) > 0 {
+		ext = exts[0]
+	}
+	return fmt.Sprintf("shady-%s.%s", time.Now().Format("20060102-150405.000"), ext)
+}
+
+func (wc *windowCapture) screenshot(img image.Image) {
+	format := encode.Formats["png"]
+	name := captureName(format)
+	wc.wg.Add(1)
+	go func() {
+		defer wc.wg.Done()
+		w, err := openWriter(format, name)
+		if err != nil {
+			log.Printf("Unable to save screenshot: %v", err)
+			return
+		}
+		defer w.Close()
+		if err := format.Encode(w, img); err != nil {
+			log.Printf("Unable to save screenshot: %v", err)
+			return
+		}
+		log.Printf("Saved screenshot to %s", name)
+	}()
+}
+
+func (wc *windowCapture) record(interval time.Duration) (chan<- image.Image, error) {
+	name := captureName(wc.format)
+	w, err := openWriter(wc.format, name)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Recording to %s", name)
+	stream := make(chan image.Image, 60)
+	wc.wg.Add(1)
+	go func() {
+		defer wc.wg.Done()
+		defer w.Close()
+		if err := wc.format.EncodeAnimation(w, stream, interval); err != nil {
+			log.Printf("Error recording to %s: %v", name, err)
+			for range stream {
+			}
+			return
+		}
+		log.Printf("Saved recording to %s", name)
+	}()
+	return stream, nil
+}
+
+// wait blocks until all captures are written.
+func (wc *windowCapture) wait() {
+	wc.wg.Wait()
+}
@@ -0,0 +1,242 @@
+package encode
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"io"
+	"time"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// APNGFormat encodes animations as Animated PNG with 8-bit RGBA frames.
+//
+// The number of frames is stored in the header, so the output is buffered
+// in memory unless it can be seeked to update the header afterwards.
+type APNGFormat struct{}
+
+func (f APNGFormat) Extensions() []string {
+	return []string{"apng"}
+}
+
+func (f APNGFormat) Encode(w io.Writer, img image.Image) error {
+	stream := make(chan image.Image, 1)
+	stream <- img
+	close(stream)
+	return f.EncodeAnimation(w, stream, 0)
+}
+
+func (f APNGFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	out := w
+	var buf *bytes.Buffer
+	var start int64
+	ws, seekable := w.(io.WriteSeeker)
+	if seekable {
+		var err error
+		start, err = ws.Seek(0, io.SeekCurrent)
+		seekable = err == nil
+	}
+	if !seekable {
+		buf = &bytes.Buffer{}
+		out = buf
+	}
+
+	delayNum, delayDen := apngDelay(interval)
+	var size image.Point
+	var numFrames, seq uint32
+	var acTLOffset int64
+	for img := range stream {
+		if numFrames == 0 {
+			size = img.Bounds().Size()
+			ihdr := make([]byte, 13)
+			binary.BigEndian.PutUint32(ihdr[0:], uint32(size.X))
+			binary.BigEndian.PutUint32(ihdr[4:], uint32(size.Y))
+			ihdr[8] = 8 // Bit depth.
+			ihdr[9] = 6 // Color type: RGBA.
+			if _, err := out.Write(pngSignature); err != nil {
+				return err
+			}
+			if err := writePNGChunk(out, "IHDR", ihdr); err != nil {
+				return err
+			}
+			acTLOffset = int64(len(pngSignature) + 12 + len(ihdr))
+			// The number of frames is updated when the animation has ended.
+			if err := writePNGChunk(out, "acTL", make([]byte, 8)); err != nil {
+				return err
+			}
+		} else if img.Bounds().Size() != size {
+			return fmt.Errorf("apng frame size changed from %v to %v", size, img.Bounds().Size())
+		}
+
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:], seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(size.X))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(size.Y))
+		binary.BigEndian.PutUint16(fctl[20:], delayNum)
+		binary.BigEndian.PutUint16(fctl[22:], delayDen)
+		// Leave the offsets, dispose and blend operations zero to replace the
+		// whole canvas with each frame.
+		if err := writePNGChunk(out, "fcTL", fctl); err != nil {
+			return err
+		}
+		seq++
+
+		data, err := pngImageData(img)
+		if err != nil {
+			return err
+		}
+		if numFrames == 0 {
+			// The first frame doubles as the default image.
+			err = writePNGChunk(out, "IDAT", data)
+		} else {
+			var seqBuf [4]byte
+			binary.BigEndian.PutUint32(seqBuf[:], seq)
+			seq++
+			err = writePNGChunk(out, "fdAT", append(seqBuf[:], data...))
+		}
+		if err != nil {
+			return err
+		}
+		numFrames++
+	}
+	if numFrames == 0 {
+		return nil
+	}
+	if err := writePNGChunk(out, "IEND", nil); err != nil {
+		return err
+	}
+
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl[0:], numFrames)
+	var chunk bytes.Buffer
+	writePNGChunk(&chunk, "acTL", actl)
+	if !seekable {
+		copy(buf.Bytes()[acTLOffset:], chunk.Bytes())
+		_, err := buf.WriteTo(w)
+		return err
+	}
+	end, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := ws.Seek(start+acTLOffset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := ws.Write(chunk.Bytes()); err != nil {
+		return err
+	}
+	_, err = ws.Seek(end, io.SeekStart)
+	return err
+}
+
+// apngDelay expresses the interval as the fraction of seconds used by fcTL
+// chunks.
+func apngDelay(interval time.Duration) (uint16, uint16) {
+	num, den := frameRateRational(interval)
+	if num <= 0xffff && den <= 0xffff {
+		return uint16(den), uint16(num)
+	}
+	return uint16(interval / time.Millisecond), 1000
+}
+
+func writePNGChunk(w io.Writer, typ string, data []byte) error {
+	buf := make([]byte, 0, 12+len(data))
+	buf = append(buf, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	buf = append(buf, typ...)
+	buf = append(buf, data...)
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(buf[4:]))
+	buf = append(buf, crc[:]...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// pngImageData returns the compressed and filtered scanlines of an image as
+// non-premultiplied 8-bit RGBA.
+func pngImageData(img image.Image) ([]byte, error) {
+	bounds := img.Bounds()
+	stride := bounds.Dx() * 4
+	cur := make([]byte, stride)
+	prev := make([]byte, stride)
+	var filtered [5][]byte
+	for i := range filtered {
+		filtered[i] = make([]byte, stride)
+	}
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			i := (x - bounds.Min.X) * 4
+			cur[i], cur[i+1], cur[i+2], cur[i+3] = c.R, c.G, c.B, c.A
+		}
+		ft := pngFilter(&filtered, cur, prev)
+		if _, err := zw.Write([]byte{ft}); err != nil {
+			return nil, err
+		}
+		if _, err := zw.Write(filtered[ft]); err != nil {
+			return nil, err
+		}
+		cur, prev = prev, cur
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pngFilter applies each of the PNG filter types to a scanline and returns
+// the one with the lowest sum of absolute differences, which is a good
+// heuristic for compressibility.
+func pngFilter(filtered *[5][]byte, cur, prev []byte) byte {
+	const bpp = 4
+	for i := range cur {
+		var a, c int
+		if i >= bpp {
+			a, c = int(cur[i-bpp]), int(prev[i-bpp])
+		}
+		b := int(prev[i])
+		filtered[0][i] = cur[i]
+		filtered[1][i] = cur[i] - byte(a)
+		filtered[2][i] = cur[i] - byte(b)
+		filtered[3][i] = cur[i] - byte((a+b)/2)
+		filtered[4][i] = cur[i] - byte(paeth(a, b, c))
+	}
+
+	best, bestSum := 0, -1
+	for ft, row := range filtered {
+		sum := 0
+		for _, v := range row {
+			sum += abs(int(int8(v)))
+		}
+		if bestSum < 0 || sum < bestSum {
+			best, bestSum = ft, sum
+		}
+	}
+	return byte(best)
+}
+
+func paeth(a, b, c int) int {
+	p := a + b - c
+	pa, pb, pc := abs(p-a), abs(p-b), abs(p-c)
+	if pa <= pb && pa <= pc {
+		return a
+	} else if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
@@ -0,0 +1,79 @@
+package encode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testAPNG(t *testing.T, data []byte) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := color.NRGBAModel.Convert(img.At(1, 1)).(color.NRGBA); c != (color.NRGBA{R: 255, G: 128, B: 0, A: 128}) {
+		t.Fatalf("unexpected color of the default image: %v", c)
+	}
+
+	chunks := map[string]int{}
+	var numFrames uint32
+	for b := data[len(pngSignature):]; len(b) > 0; {
+		length := binary.BigEndian.Uint32(b)
+		typ := string(b[4:8])
+		chunks[typ]++
+		if typ == "acTL" {
+			numFrames = binary.BigEndian.Uint32(b[8:])
+		}
+		b = b[12+length:]
+	}
+	if numFrames != 3 {
+		t.Fatalf("unexpected number of frames in acTL: exp %v, got %v", 3, numFrames)
+	}
+	if chunks["fcTL"] != 3 || chunks["IDAT"] != 1 || chunks["fdAT"] != 2 {
+		t.Fatalf("unexpected chunks: %v", chunks)
+	}
+}
+
+func testAPNGStream() <-chan image.Image {
+	stream := make(chan image.Image, 3)
+	for i := 0; i < cap(stream); i++ {
+		img := image.NewNRGBA(image.Rect(0, 0, 3, 3))
+		for j := range img.Pix {
+			img.Pix[j] = []byte{255, 128, 0, 128}[j%4]
+		}
+		stream <- img
+	}
+	close(stream)
+	return stream
+}
+
+func TestAPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (APNGFormat{}).EncodeAnimation(&buf, testAPNGStream(), time.Second/30); err != nil {
+		t.Fatal(err)
+	}
+	testAPNG(t, buf.Bytes())
+}
+
+func TestAPNGSeekable(t *testing.T) {
+	fd, err := os.Create(filepath.Join(t.TempDir(), "test.apng"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	if err := (APNGFormat{}).EncodeAnimation(fd, testAPNGStream(), time.Second/30); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(fd.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testAPNG(t, data)
+}
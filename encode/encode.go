@@ -4,9 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"image"
-	"image/color/palette"
+	"image/color"
 	"image/draw"
-	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"io"
@@ -32,6 +31,43 @@ func (f PNGFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, inter
 	return nil
 }
 
+// PNG16Format encodes PNG images with 16 bits per channel. Values outside
+// [0, 1] are clamped.
+type PNG16Format struct{}
+
+func (f PNG16Format) Extensions() []string {
+	return []string{}
+}
+
+func (f PNG16Format) IsHDR() bool {
+	return true
+}
+
+func (f PNG16Format) Encode(w io.Writer, img image.Image) error {
+	return png.Encode(w, toRGBA64(img))
+}
+
+func (f PNG16Format) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	for img := range stream {
+		if err := f.Encode(w, img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toRGBA64 converts an image to 16 bits per channel, so the PNG encoder
+// writes all 16 bits.
+func toRGBA64(img image.Image) *image.RGBA64 {
+	if rgba, ok := img.(*image.RGBA64); ok {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA64(b)
+	draw.Draw(rgba, b, img, b.Min, draw.Src)
+	return rgba
+}
+
 type JPGFormat struct{}
 
 func (f JPGFormat) Extensions() []string {
@@ -58,6 +94,22 @@ func (f RGB24Format) Extensions() []string {
 }
 
 func (f RGB24Format) Encode(w io.Writer, img image.Image) error {
+	_, err := w.Write(rgbBytes(img))
+	return err
+}
+
+func (f RGB24Format) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	for img := range stream {
+		if err := f.Encode(w, img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rgbBytes returns the pixels of an image as packed 24-bit RGB values in
+// row-major order.
+func rgbBytes(img image.Image) []byte {
 	bounds := img.Bounds()
 	buf := make([]byte, bounds.Dx()*bounds.Dy()*3)
 	if rgba, ok := img.(*image.RGBA); ok {
@@ -78,17 +130,18 @@ func (f RGB24Format) Encode(w io.Writer, img image.Image) error {
 			}
 		}
 	}
-	_, err := w.Write(buf)
-	return err
+	return buf
 }
 
-func (f RGB24Format) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
-	for img := range stream {
-		if err := f.Encode(w, img); err != nil {
-			return err
-		}
+// rgbaBytes returns the pixels of the image as 8 bit R, G, B, A in row-major
+// order.
+func rgbaBytes(img image.Image) []byte {
+	if i, ok := img.(*image.RGBA); ok {
+		return i.Pix
 	}
-	return nil
+	rgbaImg := image.NewRGBA(img.Bounds())
+	draw.Draw(rgbaImg, img.Bounds(), img, image.Point{X: 0, Y: 0}, draw.Over)
+	return rgbaImg.Pix
 }
 
 type RGBA32Format struct{}
@@ -98,14 +151,7 @@ func (f RGBA32Format) Extensions() []string {
 }
 
 func (f RGBA32Format) Encode(w io.Writer, img image.Image) error {
-	var rgbaImg *image.RGBA
-	if i, ok := img.(*image.RGBA); ok {
-		rgbaImg = i
-	} else {
-		rgbaImg = image.NewRGBA(img.Bounds())
-		draw.Draw(rgbaImg, img.Bounds(), img, image.Point{X: 0, Y: 0}, draw.Over)
-	}
-	_, err := w.Write(rgbaImg.Pix)
+	_, err := w.Write(rgbaBytes(img))
 	return err
 }
 
@@ -118,40 +164,13 @@ func (f RGBA32Format) EncodeAnimation(w io.Writer, stream <-chan image.Image, in
 	return nil
 }
 
-type GIFFormat struct{}
-
-func (f GIFFormat) Extensions() []string {
-	return []string{"gif"}
-}
-
-func (f GIFFormat) Encode(w io.Writer, img image.Image) error {
-	// Forward to the code stream encoder for easy code reuse.
-	stream := make(chan image.Image, 1)
-	stream <- img
-	close(stream)
-	return f.EncodeAnimation(w, stream, 0)
-}
-
-func (f GIFFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
-	gifImg := &gif.GIF{
-		Image:           []*image.Paletted{},
-		Delay:           []int{},
-		LoopCount:       0,
-		Disposal:        []byte{},
-		BackgroundIndex: 0,
-	}
-	for img := range stream {
-		frame := image.NewPaletted(img.Bounds(), palette.Plan9)
-		draw.Draw(frame, img.Bounds(), img, image.Point{X: 0, Y: 0}, draw.Over)
-		gifImg.Image = append(gifImg.Image, frame)
-		gifImg.Delay = append(gifImg.Delay, int(interval/(time.Second/100)))
-		gifImg.Disposal = append(gifImg.Disposal, gif.DisposalBackground)
-	}
-	return gif.EncodeAll(w, gifImg)
-}
-
 type AnsiDisplay struct {
+	// Colors is the number of colors supported by the terminal, either 256 or
+	// 1<<24. If 0, truecolor is used if the terminal advertises it.
+	Colors int
+
 	initDone bool
+	lookup   *paletteLookup
 }
 
 func (f AnsiDisplay) Extensions() []string {
@@ -170,6 +189,24 @@ func (f *AnsiDisplay) EncodeAnimation(w io.Writer, stream <-chan image.Image, in
 	// This implementation is taken from Ledcat:
 	// https://github.com/billtraill/ledcat
 
+	if f.Colors == 0 {
+		f.Colors = 256
+		if supportsTrueColor() {
+			f.Colors = 1 << 24
+		}
+	}
+	if f.Colors == 256 && f.lookup == nil {
+		f.lookup = newXterm256Lookup()
+	}
+	setColor := func(buf *bytes.Buffer, layer int, c color.Color) {
+		r, g, b, _ := c.RGBA()
+		if f.lookup != nil {
+			fmt.Fprintf(buf, "\x1b[%d;5;%dm", layer, 16+int(f.lookup.index(int(r>>8), int(g>>8), int(b>>8))))
+		} else {
+			fmt.Fprintf(buf, "\x1b[%d;2;%d;%d;%dm", layer, r/256, g/256, b/256)
+		}
+	}
+
 	lastFrame := time.Now()
 	for img := range stream {
 		width, height := img.Bounds().Dx(), img.Bounds().Dy()
@@ -193,12 +230,10 @@ func (f *AnsiDisplay) EncodeAnimation(w io.Writer, stream <-chan image.Image, in
 		for y := 0; y < height/2+(height&1); y++ {
 			for x := 0; x < width; x++ {
 				// Set the foreground color.
-				r, g, b, _ := img.At(x, y*2).RGBA()
-				fmt.Fprintf(&buf, "\x1b[38;2;%d;%d;%dm", r/256, g/256, b/256)
+				setColor(&buf, 38, img.At(x, y*2))
 				// Set the background color.
 				if y*2+1 < img.Bounds().Dy() {
-					r, g, b, _ := img.At(x, y*2+1).RGBA()
-					fmt.Fprintf(&buf, "\x1b[48;2;%d;%d;%dm", r/256, g/256, b/256)
+					setColor(&buf, 48, img.At(x, y*2+1))
 				} else {
 					fmt.Fprintf(&buf, "\x1b[48;2;0m")
 				}
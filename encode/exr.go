@@ -0,0 +1,232 @@
+package encode
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"time"
+
+	"github.com/billtraill/shady/hdr"
+)
+
+const (
+	// EXRCompressionNone stores the pixels uncompressed.
+	EXRCompressionNone = "none"
+	// EXRCompressionZIP compresses blocks of 16 scanlines with zlib.
+	EXRCompressionZIP = "zip"
+)
+
+// EXRFormat encodes single part scanline OpenEXR images with half float R, G,
+// B and A channels. Unlike other formats, values outside [0, 1] are
+// preserved if the image is an *hdr.RGBA.
+type EXRFormat struct {
+	// Compression is one of the EXRCompression* constants. Defaults to
+	// EXRCompressionZIP.
+	Compression string
+}
+
+func (f EXRFormat) Extensions() []string {
+	return []string{"exr"}
+}
+
+func (f EXRFormat) IsHDR() bool {
+	return true
+}
+
+func (f EXRFormat) Encode(w io.Writer, img image.Image) error {
+	var compression byte
+	linesPerBlock := 1
+	switch f.Compression {
+	case EXRCompressionNone:
+	case EXRCompressionZIP, "":
+		compression = 3
+		linesPerBlock = 16
+	default:
+		return fmt.Errorf("unknown EXR compression: %q", f.Compression)
+	}
+
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width == 0 || height == 0 {
+		return fmt.Errorf("unable to encode an empty image")
+	}
+
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	put := func(v interface{}) {
+		binary.Write(&buf, le, v)
+	}
+	attr := func(name, typ string, size int) {
+		buf.WriteString(name + "\x00" + typ + "\x00")
+		put(int32(size))
+	}
+
+	put(uint32(0x01312f76))
+	put(uint32(2))
+
+	// The channels are sorted by name.
+	attr("channels", "chlist", 4*18+1)
+	for _, name := range []string{"A", "B", "G", "R"} {
+		buf.WriteString(name + "\x00")
+		put(int32(1)) // HALF
+		put([4]byte{})
+		put([2]int32{1, 1})
+	}
+	buf.WriteByte(0)
+	attr("compression", "compression", 1)
+	buf.WriteByte(compression)
+	window := [4]int32{0, 0, int32(width - 1), int32(height - 1)}
+	attr("dataWindow", "box2i", 16)
+	put(window)
+	attr("displayWindow", "box2i", 16)
+	put(window)
+	attr("lineOrder", "lineOrder", 1)
+	buf.WriteByte(0) // INCREASING_Y
+	attr("pixelAspectRatio", "float", 4)
+	put(float32(1))
+	attr("screenWindowCenter", "v2f", 8)
+	put([2]float32{0, 0})
+	attr("screenWindowWidth", "float", 4)
+	put(float32(1))
+	buf.WriteByte(0)
+
+	// The offset table is followed by the chunks.
+	numChunks := (height + linesPerBlock - 1) / linesPerBlock
+	tableOffset := buf.Len()
+	buf.Write(make([]byte, 8*numChunks))
+
+	line := make([]uint16, 4*width)
+	raw := make([]byte, 0, 8*width*linesPerBlock)
+	for chunk := 0; chunk < numChunks; chunk++ {
+		le.PutUint64(buf.Bytes()[tableOffset+8*chunk:], uint64(buf.Len()))
+
+		raw = raw[:0]
+		y0 := chunk * linesPerBlock
+		for y := y0; y < y0+linesPerBlock && y < height; y++ {
+			exrLine(line, img, b.Min.Y+y)
+			for _, v := range line {
+				raw = append(raw, byte(v), byte(v>>8))
+			}
+		}
+		data := raw
+		if compression != 0 {
+			compressed, err := exrZIP(raw)
+			if err != nil {
+				return err
+			}
+			// Readers treat chunks that are not smaller as uncompressed.
+			if len(compressed) < len(raw) {
+				data = compressed
+			}
+		}
+		put(int32(y0))
+		put(int32(len(data)))
+		buf.Write(data)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (f EXRFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	for img := range stream {
+		if err := f.Encode(w, img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exrLine converts a row of the image to half floats. The channels are not
+// interleaved, but stored one after the other in A, B, G, R order.
+func exrLine(line []uint16, img image.Image, y int) {
+	b := img.Bounds()
+	width := b.Dx()
+	hdrImg, isHDR := img.(*hdr.RGBA)
+	for i := 0; i < width; i++ {
+		var r, g, bl, a float32
+		if isHDR {
+			r, g, bl, a = hdrImg.FloatAt(b.Min.X+i, y)
+		} else {
+			ir, ig, ib, ia := img.At(b.Min.X+i, y).RGBA()
+			r, g, bl, a = float32(ir)/0xffff, float32(ig)/0xffff, float32(ib)/0xffff, float32(ia)/0xffff
+		}
+		line[i] = floatToHalf(a)
+		line[width+i] = floatToHalf(bl)
+		line[2*width+i] = floatToHalf(g)
+		line[3*width+i] = floatToHalf(r)
+	}
+}
+
+// exrZIP applies the byte reordering and delta predictor of OpenEXR before
+// compressing the data with zlib.
+func exrZIP(raw []byte) ([]byte, error) {
+	tmp := make([]byte, len(raw))
+	half := (len(raw) + 1) / 2
+	for i, v := range raw {
+		if i%2 == 0 {
+			tmp[i/2] = v
+		} else {
+			tmp[half+i/2] = v
+		}
+	}
+	for i := len(tmp) - 1; i > 0; i-- {
+		tmp[i] = tmp[i] - tmp[i-1] + 128
+	}
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(tmp); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// floatToHalf converts a float32 to an IEEE 754 half precision float, rounding
+// to the nearest even value.
+func floatToHalf(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23) & 0xff
+	mant := bits & 0x7fffff
+
+	switch {
+	case exp == 0xff:
+		// Inf or NaN.
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case exp-127 > 15:
+		// Too large, becomes Inf.
+		return sign | 0x7c00
+	case exp-127 >= -14:
+		// Normal number.
+		h := uint32(exp-127+15)<<10 | mant>>13
+		if mant&0x1fff > 0x1000 || (mant&0x1fff == 0x1000 && h&1 == 1) {
+			// Rounding may carry into the exponent, which is correct, even
+			// when it overflows to Inf.
+			h++
+		}
+		return sign | uint16(h)
+	case exp-127 >= -25:
+		// Subnormal number.
+		mant |= 0x800000
+		shift := uint(-14-(exp-127)) + 13
+		h := mant >> shift
+		rem := mant & (1<<shift - 1)
+		halfway := uint32(1) << (shift - 1)
+		if rem > halfway || (rem == halfway && h&1 == 1) {
+			h++
+		}
+		return sign | uint16(h)
+	}
+	return sign
+}
@@ -0,0 +1,109 @@
+package encode
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/billtraill/shady/hdr"
+)
+
+func TestFloatToHalf(t *testing.T) {
+	valid := map[float32]uint16{
+		0:                         0x0000,
+		1:                         0x3c00,
+		-2:                        0xc000,
+		0.5:                       0x3800,
+		65504:                     0x7bff,
+		1e6:                       0x7c00,
+		float32(math.Inf(-1)):     0xfc00,
+		float32(math.Pow(2, -24)): 0x0001,
+		float32(math.Pow(2, -14)): 0x0400,
+		1 + 1.0/2048:              0x3c00, // Ties round to even.
+		1 + 3.0/2048:              0x3c02,
+	}
+	for f, expected := range valid {
+		if h := floatToHalf(f); h != expected {
+			t.Errorf("mismatched half for %v: exp %#04x, got %#04x", f, expected, h)
+		}
+	}
+	if h := floatToHalf(float32(math.NaN())); h&0x7c00 != 0x7c00 || h&0x3ff == 0 {
+		t.Errorf("NaN is not preserved: %#04x", h)
+	}
+}
+
+func TestEXR(t *testing.T) {
+	img := hdr.NewRGBA(image.Rect(0, 0, 5, 20))
+	for i := range img.Pix {
+		img.Pix[i] = 4
+	}
+	for _, compression := range []string{EXRCompressionNone, EXRCompressionZIP} {
+		var buf bytes.Buffer
+		if err := (EXRFormat{Compression: compression}).Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+		if binary.LittleEndian.Uint32(data) != 0x01312f76 {
+			t.Fatalf("invalid magic number: %x", data[:4])
+		}
+		end := bytes.Index(data, []byte("screenWindowWidth\x00float\x00")) + len("screenWindowWidth\x00float\x00") + 4 + 4
+		if data[end] != 0 {
+			t.Fatalf("the header is not terminated")
+		}
+
+		linesPerBlock := map[string]int{EXRCompressionNone: 1, EXRCompressionZIP: 16}[compression]
+		numChunks := (20 + linesPerBlock - 1) / linesPerBlock
+		offsets := data[end+1:]
+		for i := 0; i < numChunks; i++ {
+			offset := binary.LittleEndian.Uint64(offsets[8*i:])
+			y := int32(binary.LittleEndian.Uint32(data[offset:]))
+			size := binary.LittleEndian.Uint32(data[offset+4:])
+			chunk := data[offset+8 : offset+8+uint64(size)]
+			if y != int32(i*linesPerBlock) {
+				t.Errorf("%s: unexpected y of chunk %d: %d", compression, i, y)
+			}
+
+			lines := 20 - i*linesPerBlock
+			if lines > linesPerBlock {
+				lines = linesPerBlock
+			}
+			rawSize := lines * 5 * 4 * 2
+			if compression == EXRCompressionZIP {
+				if int(size) >= rawSize {
+					t.Fatalf("%s: chunk %d is not compressed", compression, i)
+				}
+				zr, err := zlib.NewReader(bytes.NewReader(chunk))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if chunk, err = ioutil.ReadAll(zr); err != nil {
+					t.Fatal(err)
+				}
+				for j := 1; j < len(chunk); j++ {
+					chunk[j] = chunk[j-1] + chunk[j] - 128
+				}
+				raw := make([]byte, len(chunk))
+				for j := range raw {
+					if j%2 == 0 {
+						raw[j] = chunk[j/2]
+					} else {
+						raw[j] = chunk[(len(chunk)+1)/2+j/2]
+					}
+				}
+				chunk = raw
+			}
+			if len(chunk) != rawSize {
+				t.Fatalf("%s: unexpected size of chunk %d: exp %d, got %d", compression, i, rawSize, len(chunk))
+			}
+			for j := 0; j < len(chunk); j += 2 {
+				if h := binary.LittleEndian.Uint16(chunk[j:]); h != 0x4400 {
+					t.Fatalf("%s: unexpected value in chunk %d: %#04x", compression, i, h)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package encode
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FFmpegFormat encodes video by piping raw frames into an FFmpeg subprocess.
+// The muxed output of FFmpeg is written to the output of the format.
+//
+// Because the output may not be seekable, MP4 and MOV files are written as
+// fragmented files.
+type FFmpegFormat struct {
+	// Container is the name of the FFmpeg muxer to use, e.g. "matroska".
+	Container string
+	// FileExtensions are the extensions of files written by the muxer.
+	FileExtensions []string
+	// VideoOnly indicates that the container can not hold a soundtrack.
+	VideoOnly bool
+	// Defaults are the output arguments which are used to encode for the
+	// container, e.g. the pixel format.
+	Defaults []string
+	// Audio is an optional audio file which is muxed as soundtrack.
+	Audio string
+	// AudioStart is the position in the audio file at which the soundtrack
+	// starts, for animations that do not start at time zero.
+	AudioStart time.Duration
+	// Args are additional output arguments for FFmpeg, e.g. to select the
+	// codec and quality. They take precedence over the defaults.
+	Args []string
+}
+
+func (f FFmpegFormat) Extensions() []string {
+	return f.FileExtensions
+}
+
+func (f FFmpegFormat) Encode(w io.Writer, img image.Image) error {
+	stream := make(chan image.Image, 1)
+	stream <- img
+	close(stream)
+	return f.EncodeAnimation(w, stream, 0)
+}
+
+func (f FFmpegFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	img, ok := <-stream
+	if !ok {
+		return nil
+	}
+	size := img.Bounds().Size()
+
+	cmd := exec.Command("ffmpeg", f.args(size, interval)...)
+	cmd.Stdout = w
+	var stderr tailBuffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("unable to start ffmpeg: %w", err)
+	}
+	wait := func() error {
+		if err := cmd.Wait(); err != nil {
+			return fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	}
+
+	for ; ok; img, ok = <-stream {
+		if img.Bounds().Size() != size {
+			stdin.Close()
+			wait()
+			return fmt.Errorf("ffmpeg frame size changed from %v to %v", size, img.Bounds().Size())
+		}
+		if err := (RGBA32Format{}).Encode(stdin, img); err != nil {
+			// FFmpeg has exited, which is fine if it decided it is done, e.g.
+			// because the soundtrack has ended. Report the reason otherwise.
+			stdin.Close()
+			return wait()
+		}
+	}
+	if err := stdin.Close(); err != nil {
+		return err
+	}
+	return wait()
+}
+
+func (f FFmpegFormat) args(size image.Point, interval time.Duration) []string {
+	num, den := frameRateRational(interval)
+	args := []string{
+		"-hide_banner",
+		"-loglevel", "error",
+		"-f", "rawvideo",
+		"-pixel_format", "rgba",
+		"-video_size", fmt.Sprintf("%dx%d", size.X, size.Y),
+		"-framerate", fmt.Sprintf("%d/%d", num, den),
+		"-i", "pipe:0",
+	}
+	if f.Audio != "" && !f.VideoOnly {
+		if f.AudioStart > 0 {
+			args = append(args, "-ss", fmt.Sprintf("%.3f", f.AudioStart.Seconds()))
+		}
+		args = append(args,
+			"-i", f.Audio,
+			"-map", "0:v",
+			"-map", "1:a",
+			"-shortest",
+		)
+	}
+	args = append(args, f.Defaults...)
+	if f.Container == "mp4" || f.Container == "mov" {
+		args = append(args, "-movflags", "frag_keyframe+empty_moov")
+	}
+	args = append(args, f.Args...)
+	return append(args, "-f", f.Container, "pipe:1")
+}
+
+// tailBuffer retains the last bytes written to it, which is sufficient to
+// report why a subprocess failed.
+type tailBuffer struct {
+	buf  bytes.Buffer
+	lock sync.Mutex
+}
+
+func (tb *tailBuffer) Write(p []byte) (int, error) {
+	const maxLen = 4096
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+	tb.buf.Write(p)
+	if tb.buf.Len() > maxLen {
+		tb.buf.Next(tb.buf.Len() - maxLen)
+	}
+	return len(p), nil
+}
+
+func (tb *tailBuffer) String() string {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+	return tb.buf.String()
+}
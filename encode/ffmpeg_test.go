@@ -0,0 +1,73 @@
+// +build linux
+
+package encode
+
+import (
+	"bytes"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeFFmpeg installs a shell script as ffmpeg in $PATH for the duration of
+// the test.
+func fakeFFmpeg(t *testing.T, script string) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "ffmpeg"), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	t.Cleanup(func() { os.Setenv("PATH", path) })
+}
+
+func TestFFmpegOutput(t *testing.T) {
+	fakeFFmpeg(t, `wc -c; echo "$@"`)
+
+	stream := make(chan image.Image, 2)
+	stream <- image.NewRGBA(image.Rect(0, 0, 4, 2))
+	stream <- image.NewRGBA(image.Rect(0, 0, 4, 2))
+	close(stream)
+	var buf bytes.Buffer
+	format := FFmpegFormat{Container: "matroska", Args: []string{"-c:v", "ffv1"}}
+	if err := format.EncodeAnimation(&buf, stream, time.Second/30); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if lines[0] != "64" {
+		t.Errorf("unexpected number of bytes piped to ffmpeg: %s", lines[0])
+	}
+	for _, arg := range []string{"-video_size 4x2", "-framerate 30/1", "-c:v ffv1 -f matroska pipe:1"} {
+		if !strings.Contains(lines[1], arg) {
+			t.Errorf("expected %q in ffmpeg arguments: %s", arg, lines[1])
+		}
+	}
+}
+
+func TestFFmpegError(t *testing.T) {
+	fakeFFmpeg(t, `echo "Unknown encoder 'nope'" >&2; exit 1`)
+
+	stream := make(chan image.Image, 4)
+	for i := 0; i < cap(stream); i++ {
+		stream <- image.NewRGBA(image.Rect(0, 0, 256, 256))
+	}
+	close(stream)
+	format := FFmpegFormat{Container: "matroska"}
+	err := format.EncodeAnimation(ioutil.Discard, stream, time.Second/30)
+	if err == nil || !strings.Contains(err.Error(), "Unknown encoder 'nope'") {
+		t.Fatalf("expected the ffmpeg error to be reported, got %v", err)
+	}
+}
+
+func TestFFmpegSoundtrackStart(t *testing.T) {
+	format := FFmpegFormat{Container: "matroska", Audio: "song.mp3", AudioStart: time.Second * 30}
+	args := strings.Join(format.args(image.Pt(4, 2), time.Second/30), " ")
+	if !strings.Contains(args, "-ss 30.000 -i song.mp3") {
+		t.Errorf("expected the soundtrack to start at 30s: %s", args)
+	}
+}
@@ -7,13 +7,39 @@ import (
 	"time"
 )
 
+// ffmpegVideoDefaults are the FFmpeg output arguments for video containers.
+// The pixel format is set for compatibility with most players.
+var ffmpegVideoDefaults = []string{"-pix_fmt", "yuv420p"}
+
+// ffmpegWebPDefaults are the FFmpeg output arguments for looping lossless
+// animated WebP with alpha.
+var ffmpegWebPDefaults = []string{"-c:v", "libwebp_anim", "-lossless", "1", "-pix_fmt", "bgra", "-loop", "0"}
+
 var Formats = map[string]Format{
-	"ansi":   &AnsiDisplay{},
-	"gif":    GIFFormat{},
-	"jpg":    JPGFormat{},
-	"png":    PNGFormat{},
-	"rgb24":  RGB24Format{},
-	"rgba32": RGBA32Format{},
+	"adalight": AdalightFormat{},
+	"ansi":     &AnsiDisplay{},
+	"ansi256":  &AnsiDisplay{Colors: 256},
+	"apng":     APNGFormat{},
+	"exr":      EXRFormat{Compression: EXRCompressionZIP},
+	"framed":   FramedFormat{PixelFormat: FramedRGB24, FileExtensions: []string{"bin"}},
+	"framed32": FramedFormat{PixelFormat: FramedRGBA32},
+	"gif":      GIFFormat{},
+	"http":     HTTPFormat{},
+	"jpg":      JPGFormat{},
+	"kitty":    &KittyFormat{},
+	"mkv":      FFmpegFormat{Container: "matroska", FileExtensions: []string{"mkv"}, Defaults: ffmpegVideoDefaults},
+	"mov":      FFmpegFormat{Container: "mov", FileExtensions: []string{"mov"}, Defaults: ffmpegVideoDefaults},
+	"mp4":      FFmpegFormat{Container: "mp4", FileExtensions: []string{"mp4"}, Defaults: ffmpegVideoDefaults},
+	"png":      PNGFormat{},
+	"png16":    PNG16Format{},
+	"rgb24":    RGB24Format{},
+	"rgba32":   RGBA32Format{},
+	"sixel":    &SixelFormat{},
+	"tpm2":     TPM2Format{},
+	"webm":     FFmpegFormat{Container: "webm", FileExtensions: []string{"webm"}, Defaults: ffmpegVideoDefaults},
+	"webp":     FFmpegFormat{Container: "webp", FileExtensions: []string{"webp"}, VideoOnly: true, Defaults: ffmpegWebPDefaults},
+	"y4m":      Y4MFormat{Chroma: Y4MChroma420},
+	"y4m444":   Y4MFormat{Chroma: Y4MChroma444},
 }
 
 func DetectFormat(filename string) (Format, bool) {
@@ -46,3 +72,18 @@ type Format interface {
 	// The interval parameter is the time between two images.
 	EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error
 }
+
+// An Opener is a Format that opens its own output instead of writing to a
+// regular file, e.g. a serial device.
+type Opener interface {
+	// Open opens the output specified by name, which is the value of the -o
+	// flag.
+	Open(name string) (io.WriteCloser, error)
+}
+
+// An HDRFormat is a Format that can store more than 8 bits per channel. Images
+// should be rendered with a floating point pixel format for these formats.
+type HDRFormat interface {
+	// IsHDR reports whether the format benefits from floating point images.
+	IsHDR() bool
+}
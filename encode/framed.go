@@ -0,0 +1,224 @@
+package encode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"time"
+)
+
+const (
+	// FramedMagic starts the header of every frame of the framed format.
+	FramedMagic = "SHDY"
+	// FramedVersion is the version of the framed format.
+	FramedVersion = 1
+	// FramedHeaderSize is the size of the header of each frame.
+	FramedHeaderSize = 32
+)
+
+// Pixel formats of the framed format.
+const (
+	FramedRGB24  = 1
+	FramedRGBA32 = 2
+)
+
+// FramedFormat writes raw pixels like the rgb24 and rgba32 formats, but
+// prefixes every frame with a header, so streams are self-describing and
+// readers can recover when data is lost. A stream can be read with a
+// FramedReader.
+//
+// The header is FramedHeaderSize bytes long and little endian:
+//
+//	0  [4]byte  FramedMagic
+//	4  uint8    FramedVersion
+//	5  uint8    Pixel format, FramedRGB24 or FramedRGBA32
+//	6  uint16   Reserved, 0
+//	8  uint32   Width
+//	12 uint32   Height
+//	16 uint64   Frame index, starting at 0
+//	24 int64    Presentation time in nanoseconds
+type FramedFormat struct {
+	// PixelFormat is FramedRGB24 or FramedRGBA32.
+	PixelFormat int
+	// FileExtensions is the list of extensions that are detected as this
+	// format.
+	FileExtensions []string
+}
+
+func (f FramedFormat) Extensions() []string {
+	return f.FileExtensions
+}
+
+func (f FramedFormat) Encode(w io.Writer, img image.Image) error {
+	return f.encodeFrame(w, img, 0, 0)
+}
+
+func (f FramedFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	index := uint64(0)
+	for img := range stream {
+		if err := f.encodeFrame(w, img, index, time.Duration(index)*interval); err != nil {
+			return err
+		}
+		index++
+	}
+	return nil
+}
+
+func (f FramedFormat) encodeFrame(w io.Writer, img image.Image, index uint64, pts time.Duration) error {
+	var pixels []byte
+	switch f.PixelFormat {
+	case FramedRGB24:
+		pixels = rgbBytes(img)
+	case FramedRGBA32:
+		pixels = rgbaBytes(img)
+	default:
+		return fmt.Errorf("unknown framed pixel format: %d", f.PixelFormat)
+	}
+	var header [FramedHeaderSize]byte
+	le := binary.LittleEndian
+	copy(header[:4], FramedMagic)
+	header[4] = FramedVersion
+	header[5] = byte(f.PixelFormat)
+	le.PutUint32(header[8:], uint32(img.Bounds().Dx()))
+	le.PutUint32(header[12:], uint32(img.Bounds().Dy()))
+	le.PutUint64(header[16:], index)
+	le.PutUint64(header[24:], uint64(pts))
+	// The header and pixels are written at once so a frame is never split
+	// when writing to a pipe that is read by multiple processes.
+	_, err := w.Write(append(header[:], pixels...))
+	return err
+}
+
+// A Frame is a frame decoded by a FramedReader.
+type Frame struct {
+	Index uint64
+	// PTS is the presentation time of the frame relative to the start of the
+	// stream.
+	PTS   time.Duration
+	Image image.Image
+}
+
+// FramedReader decodes streams written by FramedFormat.
+type FramedReader struct {
+	r io.Reader
+	// buf holds the bytes that were read from r, of which those from off
+	// have not been decoded yet. It grows with the data that is received, so
+	// a corrupted header that announces a large frame does not allocate it.
+	buf []byte
+	off int
+	err error
+	// Skipped is the number of bytes that were skipped to find the start of
+	// a frame after data was lost.
+	Skipped int
+}
+
+// NewFramedReader returns a reader that decodes frames from r.
+func NewFramedReader(r io.Reader) *FramedReader {
+	return &FramedReader{r: r}
+}
+
+// peek returns at least n bytes that have not been decoded yet. Fewer bytes
+// are only returned with the error that ended the stream.
+func (fr *FramedReader) peek(n int) ([]byte, error) {
+	if len(fr.buf)-fr.off < n {
+		// Move the remaining bytes to the start of the buffer to make room.
+		fr.buf = fr.buf[:copy(fr.buf, fr.buf[fr.off:])]
+		fr.off = 0
+	}
+	for len(fr.buf) < n && fr.err == nil {
+		if len(fr.buf) == cap(fr.buf) {
+			buf := make([]byte, len(fr.buf), 2*cap(fr.buf)+4096)
+			copy(buf, fr.buf)
+			fr.buf = buf
+		}
+		var m int
+		m, fr.err = fr.r.Read(fr.buf[len(fr.buf):cap(fr.buf)])
+		fr.buf = fr.buf[:len(fr.buf)+m]
+	}
+	if len(fr.buf) < n {
+		return fr.buf[fr.off:], fr.err
+	}
+	return fr.buf[fr.off:], nil
+}
+
+// discard marks n bytes as decoded.
+func (fr *FramedReader) discard(n int) {
+	fr.off += n
+}
+
+// Next decodes the next frame. If the stream does not continue with a valid
+// frame, bytes are skipped until the next one is found. At the end of the
+// stream, io.EOF is returned.
+func (fr *FramedReader) Next() (*Frame, error) {
+	for {
+		header, err := fr.peek(FramedHeaderSize)
+		if err == io.EOF && len(header) == 0 {
+			return nil, io.EOF
+		} else if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return nil, err
+		}
+		header = header[:FramedHeaderSize]
+		if !bytes.Equal(header[:4], []byte(FramedMagic)) || header[4] != FramedVersion || (header[5] != FramedRGB24 && header[5] != FramedRGBA32) {
+			if i := bytes.Index(header[1:], []byte(FramedMagic[:1])); i >= 0 {
+				fr.Skipped += i + 1
+				fr.discard(i + 1)
+			} else {
+				fr.Skipped += len(header)
+				fr.discard(len(header))
+			}
+			continue
+		}
+
+		le := binary.LittleEndian
+		pixelFormat := header[5]
+		width, height := int(le.Uint32(header[8:])), int(le.Uint32(header[12:]))
+		frame := &Frame{
+			Index: le.Uint64(header[16:]),
+			PTS:   time.Duration(le.Uint64(header[24:])),
+		}
+		if width <= 0 || height <= 0 || width*height > 1<<26 {
+			// Not a sensible header, treat it as garbage.
+			fr.Skipped++
+			fr.discard(1)
+			continue
+		}
+
+		// A frame is only accepted if it is followed by another frame or the
+		// end of the stream, so data that is lost within a frame is detected.
+		bytesPerPixel := 3
+		if pixelFormat == FramedRGBA32 {
+			bytesPerPixel = 4
+		}
+		size := FramedHeaderSize + width*height*bytesPerPixel
+		data, err := fr.peek(size + len(FramedMagic))
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(data) > size+len(FramedMagic) {
+			data = data[:size+len(FramedMagic)]
+		}
+		if len(data) != size && (len(data) < size+len(FramedMagic) || !bytes.Equal(data[size:], []byte(FramedMagic))) {
+			fr.Skipped++
+			fr.discard(1)
+			continue
+		}
+		pixels := data[FramedHeaderSize:size]
+
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		if pixelFormat == FramedRGBA32 {
+			copy(img.Pix, pixels)
+		} else {
+			for i := 0; i < width*height; i++ {
+				copy(img.Pix[i*4:i*4+3], pixels[i*3:i*3+3])
+				img.Pix[i*4+3] = 0xff
+			}
+		}
+		fr.discard(size)
+		frame.Image = img
+		return frame, nil
+	}
+}
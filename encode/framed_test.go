@@ -0,0 +1,88 @@
+package encode
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestFramed(t *testing.T) {
+	for _, pixelFormat := range []int{FramedRGB24, FramedRGBA32} {
+		img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+		for i := range img.Pix {
+			img.Pix[i] = byte(i)
+			if i%4 == 3 {
+				img.Pix[i] = 0xff
+			}
+		}
+		stream := make(chan image.Image, 3)
+		for i := 0; i < 3; i++ {
+			stream <- img
+		}
+		close(stream)
+		var buf bytes.Buffer
+		if err := (FramedFormat{PixelFormat: pixelFormat}).EncodeAnimation(&buf, stream, time.Second/25); err != nil {
+			t.Fatal(err)
+		}
+
+		// Drop a byte from the second frame, the reader should skip it and
+		// recover at the third.
+		data := buf.Bytes()
+		frameSize := len(data) / 3
+		data = append(data[:frameSize+FramedHeaderSize+1:frameSize+FramedHeaderSize+1], data[frameSize+FramedHeaderSize+2:]...)
+
+		fr := NewFramedReader(bytes.NewReader(data))
+		var frames []*Frame
+		for {
+			frame, err := fr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			frames = append(frames, frame)
+		}
+		if len(frames) != 2 || frames[0].Index != 0 || frames[1].Index != 2 {
+			t.Fatalf("unexpected frames for pixel format %d: %+v", pixelFormat, frames)
+		}
+		if frames[1].PTS != time.Second*2/25 {
+			t.Errorf("unexpected presentation time: %v", frames[1].PTS)
+		}
+		if fr.Skipped == 0 {
+			t.Errorf("expected bytes to be skipped")
+		}
+		if decoded := frames[0].Image.(*image.RGBA); !bytes.Equal(decoded.Pix, img.Pix) {
+			t.Errorf("mismatched pixels for pixel format %d:\nexp %v\ngot %v", pixelFormat, img.Pix, decoded.Pix)
+		}
+	}
+}
+
+func TestFramedCorruptHeader(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	var buf bytes.Buffer
+	if err := (FramedFormat{PixelFormat: FramedRGBA32}).Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	// A header that announces a frame of 4096x4096 pixels, which is never
+	// sent, is followed by a small frame.
+	corrupt := append([]byte{}, buf.Bytes()[:FramedHeaderSize]...)
+	corrupt[9], corrupt[13] = 0x10, 0x10
+	data := append(corrupt, buf.Bytes()...)
+
+	fr := NewFramedReader(bytes.NewReader(data))
+	frame, err := fr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Image.Bounds().Dx() != 2 || fr.Skipped != FramedHeaderSize {
+		t.Errorf("unexpected frame of %v after skipping %d bytes", frame.Image.Bounds(), fr.Skipped)
+	}
+	if cap(fr.buf) > 1<<16 {
+		t.Errorf("the buffer grew to %d bytes for %d bytes of data", cap(fr.buf), len(data))
+	}
+	if _, err := fr.Next(); err != io.EOF {
+		t.Errorf("expected the end of the stream, got %v", err)
+	}
+}
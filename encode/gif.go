@@ -0,0 +1,632 @@
+package encode
+
+import (
+	"bufio"
+	"compress/lzw"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// GIFPaletteFrame generates an adaptive palette for every frame.
+	GIFPaletteFrame = "frame"
+	// GIFPaletteGlobal generates an adaptive palette from the first frame
+	// which is used for the whole animation.
+	GIFPaletteGlobal = "global"
+	// GIFPalettePlan9 uses the fixed Plan9 palette for the whole animation.
+	GIFPalettePlan9 = "plan9"
+
+	// GIFDitherFloydSteinberg diffuses the quantization error to neighbouring
+	// pixels.
+	GIFDitherFloydSteinberg = "floyd-steinberg"
+	// GIFDitherOrdered applies an 8x8 Bayer matrix, which is more stable
+	// between frames than error diffusion.
+	GIFDitherOrdered = "ordered"
+	// GIFDitherNone maps every pixel to the nearest color.
+	GIFDitherNone = "none"
+)
+
+const (
+	gifDisposalNone       = 1
+	gifDisposalBackground = 2
+)
+
+// GIFFormat encodes animated GIF images.
+//
+// Frames are written as soon as they are encoded rather than buffering the
+// whole animation. Only the region that changed since the previous frame is
+// stored and unchanged pixels are made transparent to reduce the file size.
+type GIFFormat struct {
+	// Palette selects how the palette is generated. Defaults to
+	// GIFPaletteFrame.
+	Palette string
+	// Dither selects the dithering method. Defaults to
+	// GIFDitherFloydSteinberg.
+	Dither string
+}
+
+// gifFrame is a frame which has been quantized but not yet written.
+type gifFrame struct {
+	img         *image.Paletted
+	transparent int
+	delay       int
+	disposal    byte
+}
+
+func (f GIFFormat) Extensions() []string {
+	return []string{"gif"}
+}
+
+func (f GIFFormat) Encode(w io.Writer, img image.Image) error {
+	stream := make(chan image.Image, 1)
+	stream <- img
+	close(stream)
+	return f.encode(w, stream, 0, false)
+}
+
+func (f GIFFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	return f.encode(w, stream, interval, true)
+}
+
+func (f GIFFormat) encode(w io.Writer, stream <-chan image.Image, interval time.Duration, animated bool) error {
+	paletteMode, dither := f.Palette, f.Dither
+	if paletteMode == "" {
+		paletteMode = GIFPaletteFrame
+	}
+	if dither == "" {
+		dither = GIFDitherFloydSteinberg
+	}
+	switch paletteMode {
+	case GIFPaletteFrame, GIFPaletteGlobal, GIFPalettePlan9:
+	default:
+		return fmt.Errorf("unknown gif palette: %q", paletteMode)
+	}
+	switch dither {
+	case GIFDitherFloydSteinberg, GIFDitherOrdered, GIFDitherNone:
+	default:
+		return fmt.Errorf("unknown gif dithering method: %q", dither)
+	}
+
+	bw := bufio.NewWriter(w)
+	var size image.Point
+	var global color.Palette
+	var lookup *paletteLookup
+	// newFrame quantizes the area of the image within bounds. If deltaPrev is
+	// set, pixels that are the same in it are transparent.
+	newFrame := func(img *image.NRGBA, bounds image.Rectangle, deltaPrev *image.NRGBA) *gifFrame {
+		pal, frameLookup := global, lookup
+		if pal == nil {
+			pal = medianCut(img, bounds, deltaPrev, 255)
+			frameLookup = newPaletteLookup(pal)
+		}
+		transparent := -1
+		if len(pal) < 256 {
+			transparent = len(pal)
+			pal = append(pal[:len(pal):len(pal)], color.NRGBA{})
+		}
+		frame := image.NewPaletted(bounds, pal)
+		quantize(frame, img, deltaPrev, frameLookup, transparent, dither)
+		return &gifFrame{
+			img:         frame,
+			transparent: transparent,
+			disposal:    gifDisposalNone,
+		}
+	}
+	var prev *image.NRGBA
+	var pending *gifFrame
+	frameNum := 0
+	for img := range stream {
+		cur := image.NewNRGBA(image.Rectangle{Max: img.Bounds().Size()})
+		draw.Draw(cur, cur.Rect, img, img.Bounds().Min, draw.Src)
+		delay := gifDelay(interval, frameNum)
+		frameNum++
+
+		if pending == nil {
+			size = cur.Rect.Size()
+			switch paletteMode {
+			case GIFPalettePlan9:
+				global = palette.Plan9
+			case GIFPaletteGlobal:
+				global = medianCut(cur, cur.Rect, nil, 255)
+			}
+			if global != nil {
+				lookup = newPaletteLookup(global)
+			}
+			if err := writeGIFHeader(bw, size, gifColorTable(global), animated); err != nil {
+				return err
+			}
+		} else if cur.Rect.Size() != size {
+			return fmt.Errorf("gif frame size changed from %v to %v", size, cur.Rect.Size())
+		}
+
+		// Pixels of a frame with transparency must not be blended with the
+		// previous frame, so that needs to be cleared after it was shown.
+		hasAlpha := !cur.Opaque()
+		bounds := cur.Rect
+		var deltaPrev *image.NRGBA
+		if pending != nil {
+			changed := changedBounds(prev, cur)
+			if changed.Empty() {
+				pending.delay += delay
+				continue
+			}
+			if !hasAlpha && len(global) < 256 {
+				deltaPrev, bounds = prev, changed
+			}
+			if hasAlpha {
+				// Disposal only clears the area of a frame, so the previous
+				// frame must cover the canvas to clear what older frames
+				// left there.
+				if pending.img.Rect != prev.Rect {
+					pendingDelay := pending.delay
+					pending = newFrame(prev, prev.Rect, nil)
+					pending.delay = pendingDelay
+				}
+				pending.disposal = gifDisposalBackground
+			}
+			if err := writeGIFFrame(bw, pending, global == nil); err != nil {
+				return err
+			}
+		}
+
+		pending = newFrame(cur, bounds, deltaPrev)
+		pending.delay = delay
+		prev = cur
+	}
+	if pending == nil {
+		return nil
+	}
+	if err := writeGIFFrame(bw, pending, global == nil); err != nil {
+		return err
+	}
+	bw.WriteByte(0x3b) // Trailer.
+	return bw.Flush()
+}
+
+// gifDelay returns the delay of a frame in hundredths of a second. The
+// rounding error is not accumulated, so the average frame rate is retained.
+// GIF viewers commonly slow down delays shorter than 2, so that is the
+// minimum.
+func gifDelay(interval time.Duration, frameNum int) int {
+	if interval <= 0 {
+		return 0
+	}
+	cs := func(n int) int {
+		return int(math.Round(float64(interval) * float64(n) / float64(time.Second/100)))
+	}
+	d := cs(frameNum+1) - cs(frameNum)
+	if d < 2 {
+		d = 2
+	}
+	return d
+}
+
+// gifColorTable pads a palette to a size that is a power of two as required
+// for GIF color tables. A transparent entry is added if there is room for it.
+func gifColorTable(p color.Palette) color.Palette {
+	if p == nil {
+		return nil
+	}
+	if len(p) < 256 {
+		p = append(p[:len(p):len(p)], color.NRGBA{})
+	}
+	size := 2
+	for size < len(p) {
+		size *= 2
+	}
+	for len(p) < size {
+		p = append(p, color.NRGBA{A: 0xff})
+	}
+	return p
+}
+
+func writeGIFColorTable(w *bufio.Writer, p color.Palette) {
+	for _, c := range p {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		w.Write([]byte{n.R, n.G, n.B})
+	}
+}
+
+func writeGIFHeader(w *bufio.Writer, size image.Point, table color.Palette, animated bool) error {
+	w.WriteString("GIF89a")
+	binary.Write(w, binary.LittleEndian, [2]uint16{uint16(size.X), uint16(size.Y)})
+	var flags byte = 0x70 // 8 bits of color resolution.
+	if table != nil {
+		flags |= 0x80 | gifTableBits(len(table)) - 1
+	}
+	w.Write([]byte{flags, 0, 0})
+	if table != nil {
+		writeGIFColorTable(w, table)
+	}
+	if animated {
+		// Loop indefinitely.
+		w.Write([]byte{0x21, 0xff, 0x0b})
+		w.WriteString("NETSCAPE2.0")
+		w.Write([]byte{0x03, 0x01, 0x00, 0x00, 0x00})
+	}
+	return w.Flush()
+}
+
+func writeGIFFrame(w *bufio.Writer, frame *gifFrame, local bool) error {
+	// Graphic Control Extension.
+	flags := frame.disposal << 2
+	transparent := 0
+	if frame.transparent >= 0 {
+		flags |= 0x01
+		transparent = frame.transparent
+	}
+	w.Write([]byte{0x21, 0xf9, 0x04, flags})
+	binary.Write(w, binary.LittleEndian, uint16(frame.delay))
+	w.Write([]byte{byte(transparent), 0x00})
+
+	// Image Descriptor.
+	b := frame.img.Rect
+	w.WriteByte(0x2c)
+	binary.Write(w, binary.LittleEndian, [4]uint16{uint16(b.Min.X), uint16(b.Min.Y), uint16(b.Dx()), uint16(b.Dy())})
+	bits := gifTableBits(len(frame.img.Palette))
+	if local {
+		w.WriteByte(0x80 | (bits - 1))
+		writeGIFColorTable(w, gifColorTable(frame.img.Palette)[:1<<bits])
+	} else {
+		w.WriteByte(0x00)
+	}
+
+	litWidth := int(bits)
+	if litWidth < 2 {
+		litWidth = 2
+	}
+	w.WriteByte(byte(litWidth))
+	bl := &gifBlockWriter{w: w}
+	lw := lzw.NewWriter(bl, lzw.LSB, litWidth)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := frame.img.PixOffset(b.Min.X, y)
+		if _, err := lw.Write(frame.img.Pix[i : i+b.Dx()]); err != nil {
+			return err
+		}
+	}
+	if err := lw.Close(); err != nil {
+		return err
+	}
+	bl.flush()
+	w.WriteByte(0x00) // Block terminator.
+	return w.Flush()
+}
+
+// gifTableBits returns the number of bits needed to index a color table of
+// the specified length.
+func gifTableBits(n int) byte {
+	bits := byte(1)
+	for 1<<bits < n {
+		bits++
+	}
+	return bits
+}
+
+// gifBlockWriter splits image data into sub-blocks of at most 255 bytes.
+type gifBlockWriter struct {
+	w   *bufio.Writer
+	buf [255]byte
+	n   int
+}
+
+func (bw *gifBlockWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		bw.buf[bw.n] = c
+		bw.n++
+		if bw.n == len(bw.buf) {
+			bw.flush()
+		}
+	}
+	return len(p), nil
+}
+
+func (bw *gifBlockWriter) flush() {
+	if bw.n == 0 {
+		return
+	}
+	bw.w.WriteByte(byte(bw.n))
+	bw.w.Write(bw.buf[:bw.n])
+	bw.n = 0
+}
+
+// changedBounds returns the smallest rectangle containing all pixels that
+// differ between two images of the same size.
+func changedBounds(a, b *image.NRGBA) image.Rectangle {
+	var r image.Rectangle
+	for y := b.Rect.Min.Y; y < b.Rect.Max.Y; y++ {
+		for x := b.Rect.Min.X; x < b.Rect.Max.X; x++ {
+			if !pixelEqual(a, b, x, y) {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
+
+func pixelEqual(a, b *image.NRGBA, x, y int) bool {
+	i := b.PixOffset(x, y)
+	return a.Pix[i] == b.Pix[i] && a.Pix[i+1] == b.Pix[i+1] && a.Pix[i+2] == b.Pix[i+2] && a.Pix[i+3] == b.Pix[i+3]
+}
+
+// visiblePixel reports whether a pixel should be drawn, i.e. it is not
+// transparent and, if prev is set, it changed since the previous frame.
+func visiblePixel(img, prev *image.NRGBA, x, y int) bool {
+	if img.Pix[img.PixOffset(x, y)+3] < 0x80 {
+		return false
+	}
+	return prev == nil || !pixelEqual(prev, img, x, y)
+}
+
+// medianCut generates an adaptive palette of at most n colors from the
+// visible pixels within the bounds of the image.
+func medianCut(img *image.NRGBA, bounds image.Rectangle, prev *image.NRGBA, n int) color.Palette {
+	type entry struct {
+		key   [3]uint8
+		count int
+		sum   [3]int
+	}
+	// Build a histogram of colors with 6 bits per channel.
+	hist := map[uint32]*entry{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if !visiblePixel(img, prev, x, y) {
+				continue
+			}
+			i := img.PixOffset(x, y)
+			r, g, b := img.Pix[i], img.Pix[i+1], img.Pix[i+2]
+			k := uint32(r>>2)<<12 | uint32(g>>2)<<6 | uint32(b>>2)
+			e, ok := hist[k]
+			if !ok {
+				e = &entry{key: [3]uint8{r >> 2, g >> 2, b >> 2}}
+				hist[k] = e
+			}
+			e.count++
+			e.sum[0] += int(r)
+			e.sum[1] += int(g)
+			e.sum[2] += int(b)
+		}
+	}
+	if len(hist) == 0 {
+		return color.Palette{color.NRGBA{A: 0xff}}
+	}
+
+	type box struct {
+		entries []*entry
+		count   int
+		// The channel with the largest range of values and that range.
+		widest, span int
+	}
+	newBox := func(entries []*entry) box {
+		b := box{entries: entries, span: -1}
+		for _, e := range entries {
+			b.count += e.count
+		}
+		for ch := 0; ch < 3; ch++ {
+			lo, hi := uint8(255), uint8(0)
+			for _, e := range entries {
+				if e.key[ch] < lo {
+					lo = e.key[ch]
+				}
+				if e.key[ch] > hi {
+					hi = e.key[ch]
+				}
+			}
+			if int(hi-lo) > b.span {
+				b.widest, b.span = ch, int(hi-lo)
+			}
+		}
+		return b
+	}
+
+	entries := make([]*entry, 0, len(hist))
+	for _, e := range hist {
+		entries = append(entries, e)
+	}
+	// Sort for deterministic output regardless of map iteration order.
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].key, entries[j].key
+		return uint32(a[0])<<16|uint32(a[1])<<8|uint32(a[2]) < uint32(b[0])<<16|uint32(b[1])<<8|uint32(b[2])
+	})
+	boxes := []box{newBox(entries)}
+	for len(boxes) < n {
+		// Split the box with the most pixels spread over the largest range.
+		best, bestScore := -1, 0
+		for i, b := range boxes {
+			if len(b.entries) < 2 {
+				continue
+			}
+			if score := b.span * b.count; best < 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+		b := boxes[best]
+		ch := b.widest
+		sort.SliceStable(b.entries, func(i, j int) bool {
+			return b.entries[i].key[ch] < b.entries[j].key[ch]
+		})
+		// Split at the median pixel, keeping both halves non-empty.
+		split, acc := 1, 0
+		for i, e := range b.entries[:len(b.entries)-1] {
+			acc += e.count
+			split = i + 1
+			if acc*2 >= b.count {
+				break
+			}
+		}
+		boxes[best] = newBox(b.entries[:split])
+		boxes = append(boxes, newBox(b.entries[split:]))
+	}
+
+	p := make(color.Palette, len(boxes))
+	for i, b := range boxes {
+		var sum [3]int
+		for _, e := range b.entries {
+			sum[0] += e.sum[0]
+			sum[1] += e.sum[1]
+			sum[2] += e.sum[2]
+		}
+		p[i] = color.NRGBA{
+			R: uint8((sum[0] + b.count/2) / b.count),
+			G: uint8((sum[1] + b.count/2) / b.count),
+			B: uint8((sum[2] + b.count/2) / b.count),
+			A: 0xff,
+		}
+	}
+	return p
+}
+
+// paletteLookup finds the nearest color in a palette.
+//
+// The color space is divided into cells. For each cell, the colors that
+// could be nearest to any color within it are determined the first time it
+// is used, so only a few colors need to be compared for each lookup.
+type paletteLookup struct {
+	palette [][3]int
+	cells   [16 * 16 * 16][]uint8
+}
+
+func newPaletteLookup(p color.Palette) *paletteLookup {
+	pl := &paletteLookup{palette: make([][3]int, len(p))}
+	for i, c := range p {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		pl.palette[i] = [3]int{int(n.R), int(n.G), int(n.B)}
+	}
+	return pl
+}
+
+func (pl *paletteLookup) index(r, g, b int) uint8 {
+	cell := r>>4<<8 | g>>4<<4 | b>>4
+	candidates := pl.cells[cell]
+	if candidates == nil {
+		candidates = pl.candidates(r&^15, g&^15, b&^15)
+		pl.cells[cell] = candidates
+	}
+	best, bestDist := candidates[0], math.MaxInt32
+	for _, i := range candidates {
+		c := pl.palette[i]
+		dr, dg, db := c[0]-r, c[1]-g, c[2]-b
+		if dist := dr*dr + dg*dg + db*db; dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return best
+}
+
+// candidates returns the colors that may be nearest to a color in the cell
+// starting at the specified color.
+func (pl *paletteLookup) candidates(r, g, b int) []uint8 {
+	lo, hi := [3]int{r, g, b}, [3]int{r + 15, g + 15, b + 15}
+	minDist := make([]int, len(pl.palette))
+	bound := math.MaxInt32
+	for i, c := range pl.palette {
+		var dMin, dMax int
+		for ch, v := range c {
+			near, far := 0, v-lo[ch]
+			if v < lo[ch] {
+				near, far = lo[ch]-v, hi[ch]-v
+			} else if v > hi[ch] {
+				near = v - hi[ch]
+			} else if hi[ch]-v > far {
+				far = hi[ch] - v
+			}
+			dMin += near * near
+			dMax += far * far
+		}
+		minDist[i] = dMin
+		if dMax < bound {
+			bound = dMax
+		}
+	}
+	var candidates []uint8
+	for i, d := range minDist {
+		if d <= bound {
+			candidates = append(candidates, uint8(i))
+		}
+	}
+	return candidates
+}
+
+var bayer8 = [8][8]int{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// quantize maps the pixels of src within the bounds of dst to the palette of
+// dst. Pixels which are not visible are set to the transparent index if there
+// is one.
+func quantize(dst *image.Paletted, src, prev *image.NRGBA, lookup *paletteLookup, transparent int, dither string) {
+	b := dst.Rect
+	// Quantization errors of the current and next row for Floyd-Steinberg,
+	// scaled by 16. The rows have a pixel of padding on either side.
+	errCur := make([][3]int, b.Dx()+2)
+	errNext := make([][3]int, b.Dx()+2)
+	// The amplitude of ordered dithering is based on the expected distance
+	// between palette colors.
+	spread := 255 / math.Cbrt(float64(len(lookup.palette)))
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			di := dst.PixOffset(x, y)
+			ex := x - b.Min.X + 1
+			if transparent >= 0 && !visiblePixel(src, prev, x, y) {
+				dst.Pix[di] = uint8(transparent)
+				continue
+			}
+			si := src.PixOffset(x, y)
+			c := [3]int{int(src.Pix[si]), int(src.Pix[si+1]), int(src.Pix[si+2])}
+			switch dither {
+			case GIFDitherFloydSteinberg:
+				for ch := range c {
+					c[ch] = clamp8(c[ch] + errCur[ex][ch]/16)
+				}
+			case GIFDitherOrdered:
+				offset := int((float64(bayer8[y%8][x%8])/64 - 0.5) * spread)
+				for ch := range c {
+					c[ch] = clamp8(c[ch] + offset)
+				}
+			}
+			i := lookup.index(c[0], c[1], c[2])
+			dst.Pix[di] = i
+
+			if dither == GIFDitherFloydSteinberg {
+				for ch, v := range lookup.palette[i] {
+					e := c[ch] - v
+					errCur[ex+1][ch] += e * 7
+					errNext[ex-1][ch] += e * 3
+					errNext[ex][ch] += e * 5
+					errNext[ex+1][ch] += e * 1
+				}
+			}
+		}
+		errCur, errNext = errNext, errCur
+		for i := range errNext {
+			errNext[i] = [3]int{}
+		}
+	}
+}
+
+func clamp8(v int) int {
+	if v < 0 {
+		return 0
+	} else if v > 255 {
+		return 255
+	}
+	return v
+}
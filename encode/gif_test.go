@@ -0,0 +1,107 @@
+package encode
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+	"time"
+)
+
+func gradient(offset int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 16), B: 128, A: 255})
+		}
+	}
+	// Draw a moving marker so consecutive frames differ in a small region.
+	img.Set(offset, 0, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	return img
+}
+
+func TestGIF(t *testing.T) {
+	for _, dither := range []string{GIFDitherFloydSteinberg, GIFDitherOrdered, GIFDitherNone} {
+		for _, pal := range []string{GIFPaletteFrame, GIFPaletteGlobal, GIFPalettePlan9} {
+			stream := make(chan image.Image, 4)
+			stream <- gradient(0)
+			stream <- gradient(1)
+			stream <- gradient(1) // Unchanged, merged with the previous frame.
+			stream <- gradient(2)
+			close(stream)
+
+			var buf bytes.Buffer
+			format := GIFFormat{Palette: pal, Dither: dither}
+			if err := format.EncodeAnimation(&buf, stream, time.Second/25); err != nil {
+				t.Fatal(err)
+			}
+			g, err := gif.DecodeAll(&buf)
+			if err != nil {
+				t.Fatalf("palette=%s dither=%s: %v", pal, dither, err)
+			}
+			if len(g.Image) != 3 {
+				t.Fatalf("palette=%s dither=%s: unexpected number of frames: exp %d, got %d", pal, dither, 3, len(g.Image))
+			}
+			if exp := []int{4, 8, 4}; g.Delay[0] != exp[0] || g.Delay[1] != exp[1] || g.Delay[2] != exp[2] {
+				t.Errorf("palette=%s dither=%s: unexpected delays: exp %v, got %v", pal, dither, exp, g.Delay)
+			}
+			if pal != GIFPalettePlan9 && g.Image[1].Bounds().Dx() >= 64 {
+				t.Errorf("palette=%s dither=%s: expected the second frame to only contain the changed region, got %v", pal, dither, g.Image[1].Bounds())
+			}
+		}
+	}
+}
+
+func TestGIFAdaptivePalette(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 256, 1))
+	for x := 0; x < 256; x++ {
+		img.Set(x, 0, color.RGBA{R: uint8(x), G: uint8(x), B: uint8(x), A: 255})
+	}
+	var buf bytes.Buffer
+	if err := (GIFFormat{Dither: GIFDitherNone}).Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	out, err := gif.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A gray ramp should be reproduced almost exactly with an adaptive
+	// palette, unlike with Plan9.
+	for x := 0; x < 256; x++ {
+		r, _, _, _ := out.At(x, 0).RGBA()
+		if d := int(r>>8) - x; d < -2 || d > 2 {
+			t.Fatalf("pixel %d deviates too much: got %d", x, r>>8)
+		}
+	}
+}
+
+func TestGIFTransparentAfterDelta(t *testing.T) {
+	transparent := image.NewRGBA(image.Rect(0, 0, 64, 16))
+	stream := make(chan image.Image, 3)
+	stream <- gradient(0)
+	stream <- gradient(1)
+	stream <- transparent
+	close(stream)
+
+	var buf bytes.Buffer
+	if err := (GIFFormat{Dither: GIFDitherNone}).EncodeAnimation(&buf, stream, time.Second/25); err != nil {
+		t.Fatal(err)
+	}
+	g, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != 3 {
+		t.Fatalf("unexpected number of frames: exp %d, got %d", 3, len(g.Image))
+	}
+	// The frame before the transparent frame must cover the canvas, so its
+	// disposal clears everything that was drawn before.
+	full := image.Rect(0, 0, 64, 16)
+	if g.Image[1].Bounds() != full || g.Disposal[1] != gif.DisposalBackground {
+		t.Errorf("unexpected frame before the transparent frame: %v, disposal %d", g.Image[1].Bounds(), g.Disposal[1])
+	}
+	if g.Delay[1] != 4 {
+		t.Errorf("unexpected delay: %d", g.Delay[1])
+	}
+}
@@ -0,0 +1,234 @@
+package encode
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHTTPAddress is the address the HTTP server listens on if none is
+// specified.
+const DefaultHTTPAddress = ":8080"
+
+const httpIndex = `<!DOCTYPE html>
+<html>
+<head><title>Shady</title></head>
+<body style="margin: 0; background: black;">
+<img src="/stream" style="width: 100vw; height: 100vh; object-fit: contain; image-rendering: pixelated;">
+</body>
+</html>
+`
+
+// HTTPFormat serves the rendered frames over HTTP. The live stream is
+// available as Motion JPEG at /stream and the latest frame as PNG at
+// /snapshot.png. The index page shows the stream in a browser.
+//
+// Frames are encoded in the background and clients that can not keep up
+// receive only the most recent frame, so the render pipeline is never
+// stalled.
+type HTTPFormat struct {
+	// Quality is the JPEG quality of the stream, ranging from 1 to 100.
+	// Defaults to jpeg.DefaultQuality.
+	Quality int
+}
+
+func (f HTTPFormat) Extensions() []string {
+	return []string{}
+}
+
+// Open implements the Opener interface by starting a server listening on the
+// address, e.g. ":8080" or "http://localhost:8080".
+func (f HTTPFormat) Open(name string) (io.WriteCloser, error) {
+	addr := strings.TrimPrefix(name, "http://")
+	if addr == "-" || addr == "" {
+		addr = DefaultHTTPAddress
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	srv := newHTTPServer()
+	srv.server.Handler = srv.handler()
+	go func() {
+		if err := srv.server.Serve(lis); err != nil && err != http.ErrServerClosed {
+			log.Printf("HTTP server error: %v", err)
+		}
+	}()
+	return srv, nil
+}
+
+func (f HTTPFormat) Encode(w io.Writer, img image.Image) error {
+	stream := make(chan image.Image, 1)
+	stream <- img
+	close(stream)
+	return f.EncodeAnimation(w, stream, 0)
+}
+
+func (f HTTPFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	srv, ok := w.(*httpServer)
+	if !ok {
+		return fmt.Errorf("the http format requires a writer opened by HTTPFormat.Open")
+	}
+	quality := f.Quality
+	if quality == 0 {
+		quality = jpeg.DefaultQuality
+	}
+
+	// The frames are encoded by a separate goroutine, which always picks the
+	// latest frame so the stream is consumed without delay.
+	update := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range update {
+			img := srv.latestImage()
+			if !srv.hasClients() {
+				continue
+			}
+			var buf bytes.Buffer
+			if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+				log.Printf("Error encoding JPEG: %v", err)
+				continue
+			}
+			srv.broadcast(buf.Bytes())
+		}
+	}()
+	for img := range stream {
+		srv.setLatestImage(img)
+		select {
+		case update <- struct{}{}:
+		default:
+		}
+	}
+	close(update)
+	<-done
+	return nil
+}
+
+// httpServer keeps track of the latest frame and the connected stream clients.
+type httpServer struct {
+	server http.Server
+
+	lock    sync.Mutex
+	latest  image.Image
+	clients map[chan []byte]struct{}
+}
+
+func newHTTPServer() *httpServer {
+	return &httpServer{
+		clients: map[chan []byte]struct{}{},
+	}
+}
+
+// Write discards the data, the frames are passed as images.
+func (srv *httpServer) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (srv *httpServer) Close() error {
+	return srv.server.Close()
+}
+
+func (srv *httpServer) setLatestImage(img image.Image) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	srv.latest = img
+}
+
+func (srv *httpServer) latestImage() image.Image {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	return srv.latest
+}
+
+func (srv *httpServer) hasClients() bool {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	return len(srv.clients) > 0
+}
+
+// broadcast sends a frame to all clients. A client that has not yet sent its
+// previous frame gets that replaced by this one.
+func (srv *httpServer) broadcast(frame []byte) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	for client := range srv.clients {
+		select {
+		case <-client:
+		default:
+		}
+		client <- frame
+	}
+}
+
+func (srv *httpServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, httpIndex)
+	})
+	mux.HandleFunc("/snapshot.png", func(w http.ResponseWriter, r *http.Request) {
+		img := srv.latestImage()
+		if img == nil {
+			http.Error(w, "no frame has been rendered yet", http.StatusServiceUnavailable)
+			return
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(buf.Bytes())
+	})
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		client := make(chan []byte, 1)
+		srv.lock.Lock()
+		srv.clients[client] = struct{}{}
+		srv.lock.Unlock()
+		defer func() {
+			srv.lock.Lock()
+			delete(srv.clients, client)
+			srv.lock.Unlock()
+		}()
+
+		const boundary = "frame"
+		w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+boundary)
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case frame := <-client:
+				fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", boundary, len(frame))
+				w.Write(frame)
+				if _, err := io.WriteString(w, "\r\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+	return mux
+}
@@ -0,0 +1,85 @@
+package encode
+
+import (
+	"image"
+	"image/jpeg"
+	"image/png"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTP(t *testing.T) {
+	srv := newHTTPServer()
+	ts := httptest.NewServer(srv.handler())
+	defer ts.Close()
+
+	if res, err := http.Get(ts.URL + "/snapshot.png"); err != nil {
+		t.Fatal(err)
+	} else if res.Body.Close(); res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status before the first frame: %d", res.StatusCode)
+	}
+
+	res, err := http.Get(ts.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	mediaType, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/x-mixed-replace" {
+		t.Fatalf("unexpected content type: %q", res.Header.Get("Content-Type"))
+	}
+
+	// Keep producing frames until the stream has been read, the client may not
+	// be registered when the first frame is sent.
+	stream := make(chan image.Image)
+	done := make(chan error)
+	go func() {
+		done <- (HTTPFormat{}).EncodeAnimation(srv, stream, 0)
+	}()
+	received := make(chan error)
+	go func() {
+		part, err := multipart.NewReader(res.Body, params["boundary"]).NextPart()
+		if err == nil {
+			_, err = jpeg.Decode(part)
+		}
+		received <- err
+	}()
+	img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	tick := time.NewTicker(time.Millisecond * 10)
+	defer tick.Stop()
+outer:
+	for {
+		select {
+		case stream <- img:
+		case err := <-received:
+			if err != nil {
+				t.Fatal(err)
+			}
+			break outer
+		case <-time.After(time.Second * 5):
+			t.Fatal("timeout waiting for a frame")
+		}
+		<-tick.C
+	}
+	close(stream)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = http.Get(ts.URL + "/snapshot.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	snapshot, err := png.Decode(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Bounds() != img.Bounds() {
+		t.Errorf("unexpected snapshot size: %v", snapshot.Bounds())
+	}
+}
@@ -0,0 +1,175 @@
+package encode
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sequenceVerbRe matches frame number verbs and escaped percent signs, so the
+// d in "100%%d.png" is not mistaken for a verb.
+var sequenceVerbRe = regexp.MustCompile(`%%|%[-+ #0]*\d*d`)
+
+// IsSequencePattern reports whether the filename contains a printf style
+// verb for the frame number, e.g. "frame_%05d.png".
+func IsSequencePattern(filename string) bool {
+	return countSequenceVerbs(filename) > 0
+}
+
+// countSequenceVerbs returns the number of frame number verbs in a pattern.
+func countSequenceVerbs(pattern string) int {
+	n := 0
+	for _, m := range sequenceVerbRe.FindAllString(pattern, -1) {
+		if m != "%%" {
+			n++
+		}
+	}
+	return n
+}
+
+// SequenceFormat writes each frame of an animation to a separate numbered
+// file using another format.
+type SequenceFormat struct {
+	// Pattern is the printf style pattern of the filenames which takes the
+	// frame number as its only argument.
+	Pattern string
+	// Format is used to encode the individual frames.
+	Format Format
+	// Start is the number of the first frame.
+	Start int
+	// Workers is the number of frames that are encoded in parallel. If less
+	// than 1, a single worker is used.
+	Workers int
+	// SkipExisting prevents overwriting frames that have already been
+	// written, so interrupted renders can be resumed.
+	SkipExisting bool
+}
+
+// checkSequencePattern returns an error unless the pattern contains exactly
+// one frame number verb and no other verbs than escaped percent signs.
+func checkSequencePattern(pattern string) error {
+	if countSequenceVerbs(pattern) != 1 {
+		return fmt.Errorf("the sequence pattern %q should contain exactly one frame number verb", pattern)
+	}
+	if strings.Contains(sequenceVerbRe.ReplaceAllString(pattern, ""), "%") {
+		return fmt.Errorf("the sequence pattern %q contains a %% that is not the frame number verb, write %%%% for a literal %%", pattern)
+	}
+	return nil
+}
+
+func (f SequenceFormat) Extensions() []string {
+	return f.Format.Extensions()
+}
+
+// IsHDR implements the HDRFormat interface by forwarding to the format of
+// the frames.
+func (f SequenceFormat) IsHDR() bool {
+	hf, ok := f.Format.(HDRFormat)
+	return ok && hf.IsHDR()
+}
+
+// Open implements the Opener interface. The frames are written to separate
+// files, so the returned writer discards anything written to it.
+func (f SequenceFormat) Open(name string) (io.WriteCloser, error) {
+	if err := checkSequencePattern(f.Pattern); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Pattern), 0755); err != nil {
+		return nil, err
+	}
+	return nopWriteCloser{Writer: ioutil.Discard}, nil
+}
+
+func (f SequenceFormat) Encode(w io.Writer, img image.Image) error {
+	return f.writeFrame(f.Start, img)
+}
+
+func (f SequenceFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	type job struct {
+		index int
+		img   image.Image
+	}
+	workers := f.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan job)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if err := f.writeFrame(j.index, j.img); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	var err error
+	index := f.Start
+outer:
+	for img := range stream {
+		select {
+		case jobs <- job{index: index, img: img}:
+		case err = <-errs:
+			break outer
+		}
+		index++
+	}
+	close(jobs)
+	wg.Wait()
+	if err == nil {
+		select {
+		case err = <-errs:
+		default:
+		}
+	}
+	return err
+}
+
+func (f SequenceFormat) writeFrame(index int, img image.Image) error {
+	filename := fmt.Sprintf(f.Pattern, index)
+	if f.SkipExisting {
+		if _, err := os.Stat(filename); err == nil {
+			return nil
+		}
+	}
+
+	// Write to a temporary file first so no partially written frames are
+	// left behind that would be skipped when resuming.
+	tmpFilename := filepath.Join(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp")
+	fd, err := os.Create(tmpFilename)
+	if err != nil {
+		return err
+	}
+	if err := f.Format.Encode(fd, img); err != nil {
+		fd.Close()
+		os.Remove(tmpFilename)
+		return fmt.Errorf("error encoding %s: %w", filename, err)
+	}
+	if err := fd.Close(); err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+	return os.Rename(tmpFilename, filename)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,79 @@
+package encode
+
+import (
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSequence(t *testing.T) {
+	dir := t.TempDir()
+	format := SequenceFormat{
+		Pattern:      filepath.Join(dir, "frames", "frame_%03d.png"),
+		Format:       PNGFormat{},
+		Start:        10,
+		Workers:      4,
+		SkipExisting: true,
+	}
+	if _, err := format.Open(format.Pattern); err != nil {
+		t.Fatal(err)
+	}
+	// Pretend a previous render already produced the first frame.
+	existing := filepath.Join(dir, "frames", "frame_010.png")
+	if err := ioutil.WriteFile(existing, []byte("existing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stream := make(chan image.Image, 20)
+	for i := 0; i < cap(stream); i++ {
+		stream <- image.NewRGBA(image.Rect(0, 0, 4, 4))
+	}
+	close(stream)
+	if err := format.EncodeAnimation(nil, stream, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "frames"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 20 {
+		t.Fatalf("unexpected number of files: exp %v, got %v", 20, len(files))
+	}
+	if files[0].Name() != "frame_010.png" || files[19].Name() != "frame_029.png" {
+		t.Fatalf("unexpected frame numbering: %s .. %s", files[0].Name(), files[19].Name())
+	}
+	if b, _ := ioutil.ReadFile(existing); string(b) != "existing" {
+		t.Fatalf("existing frame was overwritten")
+	}
+}
+
+func TestSequenceInvalidPattern(t *testing.T) {
+	for _, pattern := range []string{"frame.png", "frame_%d_%d.png", "100%%d.png", "50%_frame_%05d.png", "%s_%d.png"} {
+		format := SequenceFormat{Pattern: filepath.Join(os.TempDir(), pattern), Format: PNGFormat{}}
+		if _, err := format.Open(format.Pattern); err == nil {
+			t.Errorf("expected an error for invalid pattern %q", pattern)
+		}
+	}
+	if err := checkSequencePattern("50%%_frame_%05d.png"); err != nil {
+		t.Errorf("unexpected error for an escaped %%: %v", err)
+	}
+}
+
+func TestIsSequencePattern(t *testing.T) {
+	patterns := map[string]bool{
+		"frame_%05d.png": true,
+		"%d.png":         true,
+		"100%%_%d.png":   true,
+		"100%%%d.png":    true,
+		"100%%d.png":     false,
+		"frame.png":      false,
+	}
+	for pattern, exp := range patterns {
+		if IsSequencePattern(pattern) != exp {
+			t.Errorf("unexpected result for %q, exp %v", pattern, exp)
+		}
+	}
+}
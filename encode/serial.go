@@ -0,0 +1,110 @@
+package encode
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+// DefaultBaudRate is the baud rate used for serial outputs if none is
+// specified.
+const DefaultBaudRate = 115200
+
+var serialOutputRe = regexp.MustCompile(`^([^;]+)(?:;(\d+))?$`)
+
+// openSerial opens a serial device specified as "<device>[;<baudrate>]", the
+// same notation that is used for serial peripheral mappings.
+func openSerial(name string) (io.WriteCloser, error) {
+	match := serialOutputRe.FindStringSubmatch(name)
+	if match == nil {
+		return nil, fmt.Errorf("could not parse serial output: %q (format: %s)", name, serialOutputRe)
+	}
+	baudrate := DefaultBaudRate
+	if match[2] != "" {
+		baudrate, _ = strconv.Atoi(match[2])
+	}
+	port, err := serial.OpenPort(&serial.Config{
+		Name: match[1],
+		Baud: baudrate,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not open serial device %q: %w", match[1], err)
+	}
+	return port, nil
+}
+
+// AdalightFormat writes frames to LED controllers running the Adalight
+// firmware. Each frame is prefixed with the "Ada" magic, the number of LEDs
+// and a checksum, followed by the RGB values of all pixels in row-major order.
+type AdalightFormat struct{}
+
+func (f AdalightFormat) Extensions() []string {
+	return []string{}
+}
+
+func (f AdalightFormat) Open(name string) (io.WriteCloser, error) {
+	return openSerial(name)
+}
+
+func (f AdalightFormat) Encode(w io.Writer, img image.Image) error {
+	pixels := rgbBytes(img)
+	numLEDs := len(pixels) / 3
+	if numLEDs == 0 || numLEDs > 1<<16 {
+		return fmt.Errorf("adalight supports 1 to %d LEDs, got %d", 1<<16, numLEDs)
+	}
+	hi, lo := byte((numLEDs-1)>>8), byte((numLEDs-1)&0xff)
+	buf := make([]byte, 0, 6+len(pixels))
+	buf = append(buf, 'A', 'd', 'a', hi, lo, hi^lo^0x55)
+	buf = append(buf, pixels...)
+	_, err := w.Write(buf)
+	return err
+}
+
+func (f AdalightFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	for img := range stream {
+		if err := f.Encode(w, img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TPM2Format writes frames to LED controllers using TPM2 serial framing. Each
+// frame is sent as a single data packet containing the RGB values of all
+// pixels in row-major order.
+type TPM2Format struct{}
+
+func (f TPM2Format) Extensions() []string {
+	return []string{}
+}
+
+func (f TPM2Format) Open(name string) (io.WriteCloser, error) {
+	return openSerial(name)
+}
+
+func (f TPM2Format) Encode(w io.Writer, img image.Image) error {
+	pixels := rgbBytes(img)
+	if len(pixels) > 0xffff {
+		return fmt.Errorf("tpm2 packets can hold at most %d bytes, got %d", 0xffff, len(pixels))
+	}
+	buf := make([]byte, 0, 5+len(pixels))
+	buf = append(buf, 0xc9, 0xda, byte(len(pixels)>>8), byte(len(pixels)&0xff))
+	buf = append(buf, pixels...)
+	buf = append(buf, 0x36)
+	_, err := w.Write(buf)
+	return err
+}
+
+func (f TPM2Format) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	for img := range stream {
+		if err := f.Encode(w, img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// +build linux
+
+package encode
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// openPTY creates a pseudo terminal pair that stands in for a serial device.
+// The master end is returned along with the name of the slave device that can
+// be opened as a serial port.
+func openPTY(t *testing.T) (*os.File, string) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("pseudo terminals are not available: %v", err)
+	}
+	t.Cleanup(func() { master.Close() })
+	if err := unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0); err != nil {
+		t.Fatal(err)
+	}
+	n, err := unix.IoctlGetInt(int(master.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return master, fmt.Sprintf("/dev/pts/%d", n)
+}
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.RGBA{R: 1, G: 2, B: 3, A: 255})
+	img.Set(1, 0, color.RGBA{R: 4, G: 5, B: 6, A: 255})
+	img.Set(0, 1, color.RGBA{R: 7, G: 8, B: 9, A: 255})
+	img.Set(1, 1, color.RGBA{R: 10, G: 11, B: 12, A: 255})
+	return img
+}
+
+func testSerialFormat(t *testing.T, format interface {
+	Format
+	Opener
+}, expected []byte) {
+	master, slave := openPTY(t)
+
+	w, err := format.Open(slave + ";115200")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	stream := make(chan image.Image, 2)
+	stream <- testImage()
+	stream <- testImage()
+	close(stream)
+	if err := format.EncodeAnimation(w, stream, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	master.SetReadDeadline(time.Now().Add(time.Second * 5))
+	buf := make([]byte, len(expected)*2)
+	if _, err := io.ReadFull(master, buf); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		frame := buf[i*len(expected) : (i+1)*len(expected)]
+		if !bytes.Equal(frame, expected) {
+			t.Fatalf("unexpected frame %d: exp %v, got %v", i, expected, frame)
+		}
+	}
+}
+
+func TestAdalight(t *testing.T) {
+	testSerialFormat(t, AdalightFormat{}, []byte{
+		'A', 'd', 'a', 0x00, 0x03, 0x56,
+		1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12,
+	})
+}
+
+func TestTPM2(t *testing.T) {
+	testSerialFormat(t, TPM2Format{}, []byte{
+		0xc9, 0xda, 0x00, 0x0c,
+		1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12,
+		0x36,
+	})
+}
+
+func TestOpenSerialInvalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"/dev/null;",
+		"/dev/null;fast",
+	}
+	for _, name := range invalid {
+		if _, err := openSerial(name); err == nil {
+			t.Errorf("expected an error while opening invalid serial output %q", name)
+		}
+	}
+}
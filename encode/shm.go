@@ -0,0 +1,84 @@
+// +build linux
+
+package encode
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"time"
+
+	"github.com/billtraill/shady/shm"
+)
+
+func init() {
+	Formats["shm"] = SHMFormat{}
+}
+
+// SHMFormat publishes frames in a shared memory ring buffer for consumers on
+// the same host, see the shm package for the layout and a reader. The name of
+// the output is the path of the shared memory file, names without a directory
+// are created in /dev/shm. Readers are notified through a Unix socket at the
+// same path with a ".sock" suffix.
+type SHMFormat struct {
+	// Slots is the number of frames in the ring buffer. Defaults to
+	// shm.DefaultNumSlots.
+	Slots int
+}
+
+func (f SHMFormat) Extensions() []string {
+	return []string{}
+}
+
+// Open implements the Opener interface. The shared memory file is created
+// when the size of the frames is known.
+func (f SHMFormat) Open(name string) (io.WriteCloser, error) {
+	if name == "-" {
+		name = "shady"
+	}
+	return &shmOutput{path: shm.Path(name)}, nil
+}
+
+func (f SHMFormat) Encode(w io.Writer, img image.Image) error {
+	stream := make(chan image.Image, 1)
+	stream <- img
+	close(stream)
+	return f.EncodeAnimation(w, stream, 0)
+}
+
+func (f SHMFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	out, ok := w.(*shmOutput)
+	if !ok {
+		return fmt.Errorf("the shm format requires a writer opened by SHMFormat.Open")
+	}
+	for img := range stream {
+		if out.writer == nil {
+			var err error
+			size := img.Bounds().Size()
+			if out.writer, err = shm.Create(out.path, size.X, size.Y, f.Slots); err != nil {
+				return err
+			}
+		}
+		if err := out.writer.WriteFrame(rgbaBytes(img), time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type shmOutput struct {
+	path   string
+	writer *shm.Writer
+}
+
+// Write discards the data, the frames are passed as images.
+func (out *shmOutput) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (out *shmOutput) Close() error {
+	if out.writer == nil {
+		return nil
+	}
+	return out.writer.Close()
+}
@@ -0,0 +1,234 @@
+package encode
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// SixelFormat displays images in terminals that support sixel graphics, like
+// xterm -ti vt340, mlterm, foot and WezTerm. Every frame is reduced to an
+// adaptive palette of 256 colors.
+type SixelFormat struct {
+	initDone bool
+}
+
+func (f SixelFormat) Extensions() []string {
+	return []string{}
+}
+
+func (f SixelFormat) Encode(w io.Writer, img image.Image) error {
+	stream := make(chan image.Image, 1)
+	stream <- img
+	close(stream)
+	return f.EncodeAnimation(w, stream, 0)
+}
+
+func (f *SixelFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	lastFrame := time.Now()
+	for img := range stream {
+		var buf bytes.Buffer
+		f.initDone = writeTerminalHome(&buf, f.initDone)
+
+		// Like the other terminal formats, alpha is ignored.
+		src := image.NewNRGBA(image.Rectangle{Max: img.Bounds().Size()})
+		for i, v := range rgbBytes(img) {
+			src.Pix[i/3*4+i%3] = v
+		}
+		for i := 3; i < len(src.Pix); i += 4 {
+			src.Pix[i] = 0xff
+		}
+		pal := medianCut(src, src.Rect, nil, 256)
+		if len(pal) == 0 {
+			pal = color.Palette{color.Black}
+		}
+		dst := image.NewPaletted(src.Rect, pal)
+		quantize(dst, src, nil, newPaletteLookup(pal), -1, GIFDitherFloydSteinberg)
+		writeSixel(&buf, dst)
+
+		if _, err := io.Copy(w, &buf); err != nil {
+			return err
+		}
+		time.Sleep(interval - time.Since(lastFrame))
+		lastFrame = time.Now()
+	}
+	return nil
+}
+
+// writeSixel writes a paletted image as a sixel sequence with square pixels.
+func writeSixel(buf *bytes.Buffer, img *image.Paletted) {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	fmt.Fprintf(buf, "\x1bP0;1;0q\"1;1;%d;%d", width, height)
+	for i, c := range img.Palette {
+		r, g, b, _ := c.RGBA()
+		fmt.Fprintf(buf, "#%d;2;%d;%d;%d", i, (r*100+0x7fff)/0xffff, (g*100+0x7fff)/0xffff, (b*100+0x7fff)/0xffff)
+	}
+
+	// Every band of 6 rows is written once for every color in it. The bits of
+	// a sixel are the rows in which the pixel has that color.
+	bits := make([][]byte, len(img.Palette))
+	for i := range bits {
+		bits[i] = make([]byte, width)
+	}
+	used := make([]bool, len(img.Palette))
+	for y0 := 0; y0 < height; y0 += 6 {
+		for y := y0; y < y0+6 && y < height; y++ {
+			row := img.Pix[y*img.Stride : y*img.Stride+width]
+			for x, c := range row {
+				bits[c][x] |= 1 << uint(y-y0)
+				used[c] = true
+			}
+		}
+		first := true
+		for c := range used {
+			if !used[c] {
+				continue
+			}
+			if !first {
+				buf.WriteByte('$')
+			}
+			first = false
+			fmt.Fprintf(buf, "#%d", c)
+			writeSixelRow(buf, bits[c])
+			for x := range bits[c] {
+				bits[c][x] = 0
+			}
+			used[c] = false
+		}
+		buf.WriteByte('-')
+	}
+	buf.WriteString("\x1b\\")
+}
+
+// writeSixelRow writes the sixels of one color in a band, using run length
+// encoding for repeated sixels.
+func writeSixelRow(buf *bytes.Buffer, row []byte) {
+	for x := 0; x < len(row); {
+		n := 1
+		for x+n < len(row) && row[x+n] == row[x] {
+			n++
+		}
+		ch := row[x] + 63
+		if n > 3 {
+			fmt.Fprintf(buf, "!%d%c", n, ch)
+		} else {
+			for i := 0; i < n; i++ {
+				buf.WriteByte(ch)
+			}
+		}
+		x += n
+	}
+}
+
+// KittyFormat displays images in terminals that implement the graphics
+// protocol of kitty, like kitty, WezTerm and Konsole. The pixels are
+// compressed, which helps when displaying over SSH.
+type KittyFormat struct {
+	initDone bool
+}
+
+func (f KittyFormat) Extensions() []string {
+	return []string{}
+}
+
+func (f KittyFormat) Encode(w io.Writer, img image.Image) error {
+	stream := make(chan image.Image, 1)
+	stream <- img
+	close(stream)
+	return f.EncodeAnimation(w, stream, 0)
+}
+
+func (f *KittyFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	lastFrame := time.Now()
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	for img := range stream {
+		var buf bytes.Buffer
+		f.initDone = writeTerminalHome(&buf, f.initDone)
+
+		compressed.Reset()
+		zw.Reset(&compressed)
+		if _, err := zw.Write(rgbBytes(img)); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		// Transmitting an image with the same image and placement ID replaces
+		// the previous frame. The terminal is asked not to respond and to
+		// leave the cursor in place.
+		payload := base64.StdEncoding.EncodeToString(compressed.Bytes())
+		const chunkSize = 4096
+		for i := 0; i < len(payload); i += chunkSize {
+			end := i + chunkSize
+			more := 1
+			if end >= len(payload) {
+				end, more = len(payload), 0
+			}
+			if i == 0 {
+				fmt.Fprintf(&buf, "\x1b_Ga=T,f=24,o=z,s=%d,v=%d,i=1,p=1,q=2,C=1,m=%d;", img.Bounds().Dx(), img.Bounds().Dy(), more)
+			} else {
+				fmt.Fprintf(&buf, "\x1b_Gm=%d;", more)
+			}
+			buf.WriteString(payload[i:end])
+			buf.WriteString("\x1b\\")
+		}
+
+		if _, err := io.Copy(w, &buf); err != nil {
+			return err
+		}
+		time.Sleep(interval - time.Since(lastFrame))
+		lastFrame = time.Now()
+	}
+	return nil
+}
+
+// writeTerminalHome clears the screen for the first frame or moves the cursor
+// to the top-left for the next ones. It returns true, so it can be used to
+// update the initDone field of terminal formats.
+func writeTerminalHome(buf *bytes.Buffer, initDone bool) bool {
+	if !initDone {
+		buf.WriteString("\x1b[3J\x1b[H\x1b[2J")
+	} else {
+		buf.WriteString("\x1b[1;1H")
+	}
+	return true
+}
+
+// supportsTrueColor reports whether the terminal advertises support for 24
+// bit colors.
+func supportsTrueColor() bool {
+	switch os.Getenv("COLORTERM") {
+	case "truecolor", "24bit":
+		return true
+	}
+	term := os.Getenv("TERM")
+	return strings.Contains(term, "truecolor") || strings.Contains(term, "24bit") || strings.Contains(term, "direct")
+}
+
+// newXterm256Lookup maps colors to the 6x6x6 color cube and grayscale ramp
+// of the xterm 256 color palette. The 16 system colors are left out as they
+// are often customized, so indices are offset by 16.
+func newXterm256Lookup() *paletteLookup {
+	levels := []uint8{0, 95, 135, 175, 215, 255}
+	p := make(color.Palette, 0, 240)
+	for _, r := range levels {
+		for _, g := range levels {
+			for _, b := range levels {
+				p = append(p, color.NRGBA{R: r, G: g, B: b, A: 255})
+			}
+		}
+	}
+	for i := 0; i < 24; i++ {
+		v := uint8(8 + i*10)
+		p = append(p, color.NRGBA{R: v, G: v, B: v, A: 255})
+	}
+	return newPaletteLookup(p)
+}
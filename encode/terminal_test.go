@@ -0,0 +1,85 @@
+package encode
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSixel(t *testing.T) {
+	img := image.NewPaletted(image.Rect(0, 0, 8, 7), color.Palette{color.Black, color.White})
+	for x := 0; x < 8; x++ {
+		img.SetColorIndex(x, 1, 1)
+		img.SetColorIndex(x, 6, 1)
+	}
+	var buf bytes.Buffer
+	writeSixel(&buf, img)
+	exp := "\x1bP0;1;0q\"1;1;8;7#0;2;0;0;0#1;2;100;100;100" +
+		"#0!8|$#1!8A-" +
+		"#1!8@-" +
+		"\x1b\\"
+	if buf.String() != exp {
+		t.Errorf("unexpected sixel data:\nexp %q\ngot %q", exp, buf.String())
+	}
+}
+
+func TestKitty(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 200))
+	rand.New(rand.NewSource(1)).Read(img.Pix)
+	var buf bytes.Buffer
+	if err := (&KittyFormat{}).Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	commands := regexp.MustCompile("\x1b_G([^;]*);([^\x1b]*)\x1b\\\\").FindAllStringSubmatch(buf.String(), -1)
+	if len(commands) < 2 {
+		t.Fatalf("expected the image to be split in chunks, got %d", len(commands))
+	}
+	if !strings.Contains(commands[0][1], "s=200,v=200") {
+		t.Errorf("unexpected control data: %q", commands[0][1])
+	}
+	var payload string
+	for i, cmd := range commands {
+		if more := strings.HasSuffix(cmd[1], "m=1"); more != (i < len(commands)-1) {
+			t.Errorf("unexpected continuation of chunk %d: %q", i, cmd[1])
+		}
+		payload += cmd[2]
+	}
+	compressed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pixels, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pixels, rgbBytes(img)) {
+		t.Errorf("the decoded pixels do not match the image")
+	}
+}
+
+func TestXterm256(t *testing.T) {
+	lookup := newXterm256Lookup()
+	valid := map[[3]int]int{
+		{0, 0, 0}:       16,
+		{255, 255, 255}: 231,
+		{255, 0, 0}:     196,
+		{128, 128, 128}: 244,
+	}
+	for c, expected := range valid {
+		if i := 16 + int(lookup.index(c[0], c[1], c[2])); i != expected {
+			t.Errorf("unexpected index for %v: exp %d, got %d", c, expected, i)
+		}
+	}
+}
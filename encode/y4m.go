@@ -0,0 +1,135 @@
+package encode
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	// Y4MChroma420 selects 4:2:0 chroma subsampling with JPEG siting.
+	Y4MChroma420 = "420jpeg"
+	// Y4MChroma444 selects full resolution chroma planes.
+	Y4MChroma444 = "444"
+)
+
+// Y4MFormat encodes frames as a YUV4MPEG2 stream. Unlike raw RGB, the stream
+// header describes the geometry and frame rate, so tools like FFmpeg can read
+// it without additional arguments.
+//
+// Colors are converted using the full range BT.601 matrix, which is signaled
+// in the header.
+type Y4MFormat struct {
+	// Chroma is the chroma subsampling of the stream, either Y4MChroma420 or
+	// Y4MChroma444.
+	Chroma string
+}
+
+func (f Y4MFormat) Extensions() []string {
+	if f.Chroma == Y4MChroma444 {
+		// Only one variant may claim the extension for DetectFormat to be
+		// deterministic.
+		return []string{}
+	}
+	return []string{"y4m"}
+}
+
+func (f Y4MFormat) Encode(w io.Writer, img image.Image) error {
+	stream := make(chan image.Image, 1)
+	stream <- img
+	close(stream)
+	return f.EncodeAnimation(w, stream, 0)
+}
+
+func (f Y4MFormat) EncodeAnimation(w io.Writer, stream <-chan image.Image, interval time.Duration) error {
+	if f.Chroma != Y4MChroma420 && f.Chroma != Y4MChroma444 {
+		return fmt.Errorf("unsupported y4m chroma subsampling: %q", f.Chroma)
+	}
+
+	bw := bufio.NewWriter(w)
+	var size image.Point
+	for img := range stream {
+		if size == (image.Point{}) {
+			size = img.Bounds().Size()
+			num, den := frameRateRational(interval)
+			fmt.Fprintf(bw, "YUV4MPEG2 W%d H%d F%d:%d Ip A1:1 C%s XCOLORRANGE=FULL\n", size.X, size.Y, num, den, f.Chroma)
+		} else if img.Bounds().Size() != size {
+			return fmt.Errorf("y4m frame size changed from %v to %v", size, img.Bounds().Size())
+		}
+
+		bw.WriteString("FRAME\n")
+		if _, err := bw.Write(f.frame(img)); err != nil {
+			return err
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// frame converts an image to planar Y'CbCr with the configured subsampling.
+func (f Y4MFormat) frame(img image.Image) []byte {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	cw, ch := w, h
+	if f.Chroma == Y4MChroma420 {
+		cw, ch = (w+1)/2, (h+1)/2
+	}
+
+	buf := make([]byte, w*h+cw*ch*2)
+	yPlane := buf[:w*h]
+	cbPlane := buf[w*h : w*h+cw*ch]
+	crPlane := buf[w*h+cw*ch:]
+	cbSum := make([]int, cw*ch)
+	crSum := make([]int, cw*ch)
+	count := make([]int, cw*ch)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			yy, cb, cr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+			yPlane[y*w+x] = yy
+
+			ci := (y*ch/h)*cw + x*cw/w
+			cbSum[ci] += int(cb)
+			crSum[ci] += int(cr)
+			count[ci]++
+		}
+	}
+	for i := range count {
+		cbPlane[i] = uint8((cbSum[i] + count[i]/2) / count[i])
+		crPlane[i] = uint8((crSum[i] + count[i]/2) / count[i])
+	}
+	return buf
+}
+
+// frameRateRational expresses the frame rate of an animation with the
+// specified interval as a fraction.
+//
+// The interval is typically derived from a floating point frame rate, so
+// common integer and NTSC style rates are recovered before falling back to
+// the exact ratio.
+func frameRateRational(interval time.Duration) (int64, int64) {
+	if interval <= 0 {
+		return 1, 1
+	}
+	fps := float64(time.Second) / float64(interval)
+	for _, den := range []int64{1, 1001} {
+		num := int64(math.Round(fps * float64(den)))
+		if num > 0 && time.Duration(float64(time.Second)*float64(den)/float64(num)) == interval {
+			return num, den
+		}
+	}
+	num, den := int64(time.Second), int64(interval)
+	for a, b := num, den; ; {
+		if b == 0 {
+			return num / a, den / a
+		}
+		a, b = b, a%b
+	}
+}
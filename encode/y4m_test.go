@@ -0,0 +1,58 @@
+package encode
+
+import (
+	"bytes"
+	"image"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrameRateRational(t *testing.T) {
+	valid := map[float64]struct {
+		num, den int64
+	}{
+		60:             {num: 60, den: 1},
+		20:             {num: 20, den: 1},
+		30000.0 / 1001: {num: 30000, den: 1001},
+		0.5:            {num: 1, den: 2},
+	}
+	for fps, expected := range valid {
+		interval := time.Duration(float64(time.Second) / fps)
+		num, den := frameRateRational(interval)
+		if num != expected.num || den != expected.den {
+			t.Errorf("mismatched frame rate for %v fps: exp %d:%d, got %d:%d", fps, expected.num, expected.den, num, den)
+		}
+	}
+}
+
+func TestY4M(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 3))
+	for _, chroma := range []struct {
+		name      string
+		frameSize int
+	}{
+		{name: Y4MChroma420, frameSize: 3*3 + 2*2*2},
+		{name: Y4MChroma444, frameSize: 3 * 3 * 3},
+	} {
+		stream := make(chan image.Image, 2)
+		stream <- img
+		stream <- img
+		close(stream)
+
+		var buf bytes.Buffer
+		if err := (Y4MFormat{Chroma: chroma.name}).EncodeAnimation(&buf, stream, time.Second/25); err != nil {
+			t.Fatal(err)
+		}
+		header, err := buf.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(header, "YUV4MPEG2 W3 H3 F25:1 ") || !strings.Contains(header, " C"+chroma.name+" ") {
+			t.Errorf("unexpected header: %q", header)
+		}
+		if exp := 2 * (len("FRAME\n") + chroma.frameSize); buf.Len() != exp {
+			t.Errorf("unexpected stream size for %s: exp %d, got %d", chroma.name, exp, buf.Len())
+		}
+	}
+}
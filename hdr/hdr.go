@@ -0,0 +1,82 @@
+// Package hdr provides an image type with floating point channels, so colors
+// can exceed the range of regular images.
+package hdr
+
+import (
+	"image"
+	"image/color"
+)
+
+// RGBA is an in-memory image with four float32 channels per pixel in R, G, B,
+// A order. Unlike other image types, the values are not clamped.
+//
+// When accessed as an image.Image, the channels are clamped to [0, 1] and
+// returned as 16 bits per channel.
+type RGBA struct {
+	// Pix holds the pixel values in row-major order.
+	Pix []float32
+	// Stride is the Pix stride (in float32s) between vertically adjacent
+	// pixels.
+	Stride int
+	// Rect is the image's bounds.
+	Rect image.Rectangle
+}
+
+// NewRGBA returns a new RGBA image with the given bounds.
+func NewRGBA(r image.Rectangle) *RGBA {
+	return &RGBA{
+		Pix:    make([]float32, 4*r.Dx()*r.Dy()),
+		Stride: 4 * r.Dx(),
+		Rect:   r,
+	}
+}
+
+func (p *RGBA) ColorModel() color.Model {
+	return color.RGBA64Model
+}
+
+func (p *RGBA) Bounds() image.Rectangle {
+	return p.Rect
+}
+
+func (p *RGBA) At(x, y int) color.Color {
+	if !(image.Point{X: x, Y: y}.In(p.Rect)) {
+		return color.RGBA64{}
+	}
+	r, g, b, a := p.FloatAt(x, y)
+	return color.RGBA64{R: clamp16(r), G: clamp16(g), B: clamp16(b), A: clamp16(a)}
+}
+
+// FloatAt returns the unclamped channel values of the pixel at (x, y).
+func (p *RGBA) FloatAt(x, y int) (r, g, b, a float32) {
+	if !(image.Point{X: x, Y: y}.In(p.Rect)) {
+		return 0, 0, 0, 0
+	}
+	i := p.PixOffset(x, y)
+	return p.Pix[i], p.Pix[i+1], p.Pix[i+2], p.Pix[i+3]
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds to
+// the pixel at (x, y).
+func (p *RGBA) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*4
+}
+
+// Opaque scans the entire image and reports whether it is fully opaque.
+func (p *RGBA) Opaque() bool {
+	for i := 3; i < len(p.Pix); i += 4 {
+		if p.Pix[i] < 1 {
+			return false
+		}
+	}
+	return true
+}
+
+func clamp16(v float32) uint16 {
+	if v <= 0 {
+		return 0
+	} else if v >= 1 {
+		return 0xffff
+	}
+	return uint16(v*0xffff + 0.5)
+}
@@ -0,0 +1,86 @@
+package playlist
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/billtraill/shady/renderer"
+	"github.com/billtraill/shady/transition"
+)
+
+// A Player plays a playlist by setting the environments of its entries on an
+// engine, so the output of the engine does not stop between entries.
+type Player struct {
+	Playlist *Playlist
+	Engine   interface{ SetEnvironment(renderer.Environment) }
+	// NewEnvironment creates the environment of an entry.
+	NewEnvironment func(e *Entry) (renderer.Environment, error)
+	// GLSLVersion is the GLSL version of the transitions.
+	GLSLVersion string
+	Verbose     bool
+}
+
+// Play plays the playlist until the context is canceled. If no entry is
+// scheduled, the current entry keeps playing.
+func (p *Player) Play(ctx context.Context) {
+	order := newOrder(p.Playlist, time.Now().UnixNano())
+	var cur *Entry
+	for ctx.Err() == nil {
+		e := order.next(time.Now())
+		if e == nil {
+			if p.Verbose {
+				log.Printf("Playlist: no entry is scheduled")
+			}
+			sleep(ctx, time.Minute)
+			continue
+		}
+		if p.Verbose {
+			log.Printf("Playlist: playing %v for %v", e.Shaders, e.Duration)
+		}
+
+		start := time.Now()
+		if e != cur {
+			if err := p.show(e); err != nil {
+				log.Printf("Playlist: unable to play %v: %v", e.Shaders, err)
+				// Avoid spinning if no entry can be played.
+				sleep(ctx, time.Second)
+				continue
+			}
+		}
+		cur = e
+		sleep(ctx, time.Duration(e.Duration)-time.Since(start))
+	}
+}
+
+// show transitions from the entry that is playing to the next entry.
+func (p *Player) show(e *Entry) error {
+	env, err := p.NewEnvironment(e)
+	if err != nil {
+		return err
+	}
+	if *e.Fade == 0 {
+		p.Engine.SetEnvironment(env)
+		return nil
+	}
+	source, err := transition.Load(e.Transition)
+	if err != nil {
+		log.Printf("Playlist: %v", err)
+		p.Engine.SetEnvironment(env)
+		return nil
+	}
+	p.Engine.SetEnvironment(transition.New(env, source, time.Duration(*e.Fade), p.GLSLVersion))
+	return nil
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
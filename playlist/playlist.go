@@ -0,0 +1,296 @@
+// Package playlist plays a list of shaders one after another, so
+// installations can cycle through many shaders without restarting.
+package playlist
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/billtraill/shady/transition"
+)
+
+// DefaultDuration is the duration of entries if the playlist does not set it.
+const DefaultDuration = time.Minute
+
+// A Playlist is a list of shaders. It is read from a JSON file, e.g.:
+//
+//	{
+//	  "shuffle": true,
+//	  "duration": "5m",
+//	  "fade": "2s",
+//	  "transition": "wipe",
+//	  "entries": [
+//	    {"shaders": ["plasma.glsl"], "uniforms": {"speed": 0.5}},
+//	    {"shaders": ["stars.glsl"], "from": "20:00", "to": "06:00"},
+//	    {"shaders": ["logo.glsl"], "map": ["logo=image:logo.png"], "duration": "30s"}
+//	  ]
+//	}
+type Playlist struct {
+	// Shuffle plays the entries in a random order. Every entry is played
+	// once before any entry is repeated.
+	Shuffle bool `json:"shuffle"`
+	// Duration, Fade and Transition are the defaults of the entries. The
+	// default transition is "fade".
+	Duration   Duration `json:"duration"`
+	Fade       Duration `json:"fade"`
+	Transition string   `json:"transition"`
+	Entries    []Entry  `json:"entries"`
+}
+
+// An Entry is a shader in a playlist.
+type Entry struct {
+	// Shaders are the source files of the shader. Relative paths are
+	// resolved relative to the playlist file.
+	Shaders []string `json:"shaders"`
+	// Mappings are mappings in the format of the -map flag. Relative paths
+	// are resolved relative to the playlist file.
+	Mappings []string `json:"map"`
+	// Uniforms sets uniforms that are declared by the shader to fixed values.
+	Uniforms map[string]Values `json:"uniforms"`
+
+	// Duration is how long the entry is shown, including the fade to the
+	// next entry.
+	Duration Duration `json:"duration"`
+	// Fade is the duration of the transition from the previous entry.
+	Fade *Duration `json:"fade"`
+	// Transition is the name of a built-in transition or a transition file,
+	// see the transition package. A relative path is resolved relative to
+	// the playlist file.
+	Transition string `json:"transition"`
+
+	// From and To limit when the entry is played to a time of day in 15:04
+	// format. If From is later than To, the entry is played overnight.
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Days limits the entry to days of the week, e.g. ["sat", "sun"].
+	Days []string `json:"days"`
+
+	// Dir is the directory of the playlist file.
+	Dir string `json:"-"`
+
+	from, to time.Duration
+	days     map[time.Weekday]bool
+}
+
+// Load reads a playlist from a file.
+func Load(filename string) (*Playlist, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var pl Playlist
+	if err := json.Unmarshal(data, &pl); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if err := pl.init(filepath.Dir(filename)); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return &pl, nil
+}
+
+// init validates the playlist and fills in the defaults of the entries.
+func (pl *Playlist) init(dir string) error {
+	if len(pl.Entries) == 0 {
+		return fmt.Errorf("the playlist has no entries")
+	}
+	if pl.Duration <= 0 {
+		pl.Duration = Duration(DefaultDuration)
+	}
+	for i := range pl.Entries {
+		e := &pl.Entries[i]
+		if len(e.Shaders) == 0 {
+			return fmt.Errorf("entry %d has no shaders", i)
+		}
+		e.Dir = dir
+		for j, s := range e.Shaders {
+			if !filepath.IsAbs(s) {
+				e.Shaders[j] = filepath.Join(dir, s)
+			}
+		}
+		if e.Duration <= 0 {
+			e.Duration = pl.Duration
+		}
+		if e.Fade == nil {
+			fade := pl.Fade
+			e.Fade = &fade
+		}
+		if *e.Fade < 0 || *e.Fade > e.Duration {
+			return fmt.Errorf("entry %d: the fade of %v is not within the duration of %v", i, *e.Fade, e.Duration)
+		}
+		if e.Transition == "" {
+			e.Transition = pl.Transition
+		}
+		if e.Transition == "" {
+			e.Transition = "fade"
+		}
+		if _, ok := transition.Builtin[e.Transition]; !ok && !filepath.IsAbs(e.Transition) {
+			e.Transition = filepath.Join(dir, e.Transition)
+		}
+		if _, err := transition.Load(e.Transition); err != nil {
+			return fmt.Errorf("entry %d: %w", i, err)
+		}
+
+		if (e.From == "") != (e.To == "") {
+			return fmt.Errorf("entry %d: from and to must be set together", i)
+		}
+		if e.From != "" {
+			var err error
+			if e.from, err = parseTimeOfDay(e.From); err != nil {
+				return fmt.Errorf("entry %d: %w", i, err)
+			}
+			if e.to, err = parseTimeOfDay(e.To); err != nil {
+				return fmt.Errorf("entry %d: %w", i, err)
+			}
+		}
+		if len(e.Days) > 0 {
+			e.days = map[time.Weekday]bool{}
+			for _, d := range e.Days {
+				wd, err := parseWeekday(d)
+				if err != nil {
+					return fmt.Errorf("entry %d: %w", i, err)
+				}
+				e.days[wd] = true
+			}
+		}
+	}
+	return nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day: %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if s = strings.ToLower(s); s == name || s == name[:3] {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day of the week: %q", s)
+}
+
+// Active reports whether the entry may be played at the specified time.
+func (e *Entry) Active(t time.Time) bool {
+	if e.days != nil && !e.days[t.Weekday()] {
+		return false
+	}
+	if e.From == "" || e.from == e.to {
+		return true
+	}
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	tod := t.Sub(day)
+	if e.from < e.to {
+		return tod >= e.from && tod < e.to
+	}
+	return tod >= e.from || tod < e.to
+}
+
+// A Duration is a time.Duration that is read from JSON as a string like
+// "1m30s" or as a number of seconds.
+type Duration time.Duration
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := time.ParseDuration(s)
+		*d = Duration(v)
+		return err
+	}
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("invalid duration: %s", data)
+	}
+	*d = Duration(f * float64(time.Second))
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Values are the values of a uniform. They are read from JSON as a number,
+// a boolean or an array of numbers, e.g. [1, 0.5, 0] for a vec3.
+type Values []float32
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (v *Values) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*v = Values{0}
+		if b {
+			*v = Values{1}
+		}
+		return nil
+	}
+	var f float32
+	if err := json.Unmarshal(data, &f); err == nil {
+		*v = Values{f}
+		return nil
+	}
+	var fs []float32
+	if err := json.Unmarshal(data, &fs); err != nil {
+		return fmt.Errorf("invalid uniform value: %s", data)
+	}
+	*v = fs
+	return nil
+}
+
+// order determines which entry of a playlist is played next.
+type order struct {
+	playlist *Playlist
+	rand     *rand.Rand
+	indices  []int
+	pos      int
+	last     int
+}
+
+func newOrder(pl *Playlist, seed int64) *order {
+	return &order{playlist: pl, rand: rand.New(rand.NewSource(seed)), last: -1}
+}
+
+// next returns the next entry that is active at the specified time, or nil if
+// no entry is active.
+func (o *order) next(t time.Time) *Entry {
+	entries := o.playlist.Entries
+	for range entries {
+		if o.pos >= len(o.indices) {
+			o.reset()
+		}
+		i := o.indices[o.pos]
+		o.pos++
+		if e := &entries[i]; e.Active(t) {
+			o.last = i
+			return e
+		}
+	}
+	return nil
+}
+
+// reset starts the next round through the entries.
+func (o *order) reset() {
+	n := len(o.playlist.Entries)
+	o.pos = 0
+	if !o.playlist.Shuffle {
+		o.indices = make([]int, n)
+		for i := range o.indices {
+			o.indices[i] = i
+		}
+		return
+	}
+	o.indices = o.rand.Perm(n)
+	// Do not play the same entry twice in a row.
+	if n > 1 && o.indices[0] == o.last {
+		o.indices[0], o.indices[1] = o.indices[1], o.indices[0]
+	}
+}
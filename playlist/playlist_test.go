@@ -0,0 +1,181 @@
+package playlist
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "playlist.json")
+	data := `{
+		"duration": "2m",
+		"fade": 1.5,
+		"transition": "wipe",
+		"entries": [
+			{"shaders": ["a.glsl"], "uniforms": {"speed": 2, "on": true, "color": [1, 0.5, 0]}},
+			{"shaders": ["/abs/b.glsl"], "duration": "10s", "fade": "0s", "from": "22:00", "to": "06:00", "days": ["sat", "Sunday"], "transition": "zoom"}
+		]
+	}`
+	if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pl, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := pl.Entries[0], pl.Entries[1]
+	if a.Shaders[0] != filepath.Join(dir, "a.glsl") || b.Shaders[0] != "/abs/b.glsl" {
+		t.Errorf("unexpected shaders: %v, %v", a.Shaders, b.Shaders)
+	}
+	if a.Dir != dir {
+		t.Errorf("unexpected dir: %q", a.Dir)
+	}
+	if a.Duration != Duration(2*time.Minute) || *a.Fade != Duration(1500*time.Millisecond) {
+		t.Errorf("unexpected defaults: %v, %v", a.Duration, *a.Fade)
+	}
+	if b.Duration != Duration(10*time.Second) || *b.Fade != 0 {
+		t.Errorf("unexpected overrides: %v, %v", b.Duration, *b.Fade)
+	}
+	if a.Transition != "wipe" || b.Transition != "zoom" {
+		t.Errorf("unexpected transitions: %q, %q", a.Transition, b.Transition)
+	}
+	expUniforms := map[string]Values{"speed": {2}, "on": {1}, "color": {1, 0.5, 0}}
+	if !reflect.DeepEqual(a.Uniforms, expUniforms) {
+		t.Errorf("unexpected uniforms: %v", a.Uniforms)
+	}
+	if !b.days[time.Saturday] || !b.days[time.Sunday] || len(b.days) != 2 {
+		t.Errorf("unexpected days: %v", b.days)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	invalid := []string{
+		`{"entries": []}`,
+		`{"entries": [{"shaders": []}]}`,
+		`{"entries": [{"shaders": ["a.glsl"], "duration": "10s", "fade": "20s"}]}`,
+		`{"entries": [{"shaders": ["a.glsl"], "from": "10:00"}]}`,
+		`{"entries": [{"shaders": ["a.glsl"], "from": "25:00", "to": "10:00"}]}`,
+		`{"entries": [{"shaders": ["a.glsl"], "days": ["someday"]}]}`,
+		`{"entries": [{"shaders": ["a.glsl"], "uniforms": {"a": "b"}}]}`,
+		`{"entries": [{"shaders": ["a.glsl"], "transition": "nonexistent.glsl"}]}`,
+	}
+	for _, data := range invalid {
+		var pl Playlist
+		err := json.Unmarshal([]byte(data), &pl)
+		if err == nil {
+			err = pl.init(".")
+		}
+		if err == nil {
+			t.Errorf("expected an error for %s", data)
+		}
+	}
+}
+
+func TestEntryActive(t *testing.T) {
+	var pl Playlist
+	data := `{"entries": [
+		{"shaders": ["day.glsl"], "from": "08:00", "to": "20:00"},
+		{"shaders": ["night.glsl"], "from": "20:00", "to": "08:00"},
+		{"shaders": ["weekend.glsl"], "days": ["sat", "sun"]}
+	]}`
+	if err := json.Unmarshal([]byte(data), &pl); err != nil {
+		t.Fatal(err)
+	}
+	if err := pl.init("."); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		time   time.Time
+		active [3]bool
+	}{
+		// 2021-06-19 is a saturday.
+		{time.Date(2021, 6, 19, 12, 0, 0, 0, time.UTC), [3]bool{true, false, true}},
+		{time.Date(2021, 6, 19, 20, 0, 0, 0, time.UTC), [3]bool{false, true, true}},
+		{time.Date(2021, 6, 21, 7, 59, 0, 0, time.UTC), [3]bool{false, true, false}},
+		{time.Date(2021, 6, 21, 8, 0, 0, 0, time.UTC), [3]bool{true, false, false}},
+	}
+	for _, c := range cases {
+		for i, exp := range c.active {
+			if got := pl.Entries[i].Active(c.time); got != exp {
+				t.Errorf("entry %d at %v: exp %v, got %v", i, c.time, exp, got)
+			}
+		}
+	}
+}
+
+func TestOrder(t *testing.T) {
+	pl := &Playlist{Entries: []Entry{{}, {}, {}, {}}}
+	now := time.Now()
+
+	o := newOrder(pl, 1)
+	var played []int
+	for i := 0; i < 6; i++ {
+		played = append(played, indexOf(pl, o.next(now)))
+	}
+	if exp := []int{0, 1, 2, 3, 0, 1}; !reflect.DeepEqual(played, exp) {
+		t.Errorf("unexpected order: %v", played)
+	}
+
+	pl.Shuffle = true
+	o = newOrder(pl, 1)
+	prev := -1
+	for round := 0; round < 10; round++ {
+		seen := map[int]bool{}
+		for range pl.Entries {
+			e := indexOf(pl, o.next(now))
+			if e == prev {
+				t.Errorf("entry %d is played twice in a row", e)
+			}
+			seen[e] = true
+			prev = e
+		}
+		if len(seen) != len(pl.Entries) {
+			t.Errorf("not every entry is played in round %d: %v", round, seen)
+		}
+	}
+}
+
+func TestOrderSchedule(t *testing.T) {
+	pl := &Playlist{Entries: []Entry{{}, {Days: []string{"mon"}}, {}}}
+	if err := pl.init("."); err == nil {
+		t.Fatal("expected an error for an entry without shaders")
+	}
+	for i := range pl.Entries {
+		pl.Entries[i].Shaders = []string{"a.glsl"}
+	}
+	if err := pl.init("."); err != nil {
+		t.Fatal(err)
+	}
+
+	// 2021-06-19 is a saturday.
+	sat := time.Date(2021, 6, 19, 12, 0, 0, 0, time.UTC)
+	o := newOrder(pl, 1)
+	var played []int
+	for i := 0; i < 4; i++ {
+		played = append(played, indexOf(pl, o.next(sat)))
+	}
+	if exp := []int{0, 2, 0, 2}; !reflect.DeepEqual(played, exp) {
+		t.Errorf("unexpected order: %v", played)
+	}
+
+	pl.Entries = pl.Entries[1:2]
+	if e := newOrder(pl, 1).next(sat); e != nil {
+		t.Errorf("expected no entry to be active")
+	}
+}
+
+func indexOf(pl *Playlist, e *Entry) int {
+	for i := range pl.Entries {
+		if &pl.Entries[i] == e {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,155 @@
+package renderer
+
+import (
+	"context"
+	"time"
+)
+
+// EngineState is the state of an engine that can be inspected and changed
+// while it is rendering, see Shader.Control.
+type EngineState struct {
+	// Environment is the environment that is rendered. During a transition,
+	// this is the environment that is transitioned to. It is nil if no
+	// environment is set up.
+	Environment Environment
+	// Uniforms are the active uniforms of Environment. They must not be
+	// modified.
+	Uniforms map[string]Uniform
+
+	// Time is the animation time of the next frame. Changing it seeks the
+	// animation.
+	Time time.Duration
+	// Frame is the number of frames that have been rendered.
+	Frame uint64
+	// Paused stops the animation time. Changing it pauses or resumes the
+	// animation.
+	Paused bool
+
+	// FPS is the number of frames that are rendered per second.
+	FPS float64
+	// Errors is the number of environments that could not be set up and
+	// LastError the error of the last of them.
+	Errors    int
+	LastError error
+}
+
+// A control is a function that is called on the render thread.
+type control struct {
+	fn   func(*EngineState)
+	done chan struct{}
+}
+
+// controlQueue queues controls for an engine.
+type controlQueue chan control
+
+func newControlQueue() controlQueue {
+	return make(controlQueue, 16)
+}
+
+// call queues fn and waits until it has been called.
+func (q controlQueue) call(ctx context.Context, fn func(*EngineState)) error {
+	c := control{fn: fn, done: make(chan struct{})}
+	select {
+	case q <- c:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// apply calls the function of the control with the state that is returned by
+// get, and passes the changed state to set.
+func (c control) apply(get func() EngineState, set func(EngineState)) {
+	state := get()
+	c.fn(&state)
+	set(state)
+	close(c.done)
+}
+
+// apply applies the controls that are queued.
+func (q controlQueue) apply(get func() EngineState, set func(EngineState)) {
+	for {
+		select {
+		case c := <-q:
+			c.apply(get, set)
+		default:
+			return
+		}
+	}
+}
+
+// Control calls fn on the render thread between two frames, so it can safely
+// inspect and change the engine and its environment. Control blocks until fn
+// returns or the context is canceled. Changes that fn makes to the Time and
+// Paused fields of the state are applied to the engine.
+func (sh *Shader) Control(ctx context.Context, fn func(*EngineState)) error {
+	return sh.controls.call(ctx, fn)
+}
+
+func (sh *Shader) controlState() EngineState {
+	// During a transition, the environment that is transitioned to is
+	// rendered by a sub shader.
+	cur := sh
+	for {
+		if _, ok := cur.env.(Transition); !ok {
+			break
+		}
+		to, ok := cur.subTargets[TransitionTo]
+		if !ok {
+			break
+		}
+		cur = to
+	}
+	return EngineState{
+		Environment: cur.env,
+		Uniforms:    cur.uniforms,
+		Time:        sh.time,
+		Frame:       sh.frame,
+		Paused:      sh.paused,
+		FPS:         sh.fps,
+		Errors:      sh.errors,
+		LastError:   sh.lastError,
+	}
+}
+
+func (sh *Shader) setControlState(state EngineState) {
+	if state.Time != sh.time {
+		sh.setTime(state.Time)
+	}
+	sh.paused = state.Paused
+}
+
+// setTime sets the animation time of the shader and its sub shaders.
+func (sh *Shader) setTime(t time.Duration) {
+	sh.time = t
+	for _, s := range sh.subTargets {
+		s.setTime(t)
+	}
+}
+
+// Control is like Shader.Control.
+func (eng *OnScreenEngine) Control(ctx context.Context, fn func(*EngineState)) error {
+	return eng.controls.call(ctx, fn)
+}
+
+func (eng *OnScreenEngine) controlState() EngineState {
+	return EngineState{
+		Environment: eng.env,
+		Uniforms:    eng.uniforms,
+		Time:        eng.time,
+		Frame:       eng.frame,
+		Paused:      eng.paused,
+		FPS:         eng.fps,
+		Errors:      eng.errors,
+		LastError:   eng.lastError,
+	}
+}
+
+func (eng *OnScreenEngine) setControlState(state EngineState) {
+	eng.time, eng.paused = state.Time, state.Paused
+}
@@ -0,0 +1,159 @@
+package renderer
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// OnScreenKeys describes the keyboard controls of the OnScreenEngine window.
+const OnScreenKeys = `Space  pause or resume
+Right  step one frame
+Home   rewind to zero
+Up     double the speed
+Down   halve the speed
+F      toggle fullscreen
+S      save a screenshot
+R      start or stop recording
+H      show or hide the status line`
+
+const (
+	// recordInterval is the time between recorded frames. Frames are
+	// recorded as they are displayed, which is usually at 60 fps.
+	recordInterval = time.Second / 60
+	minSpeed       = 1.0 / 16
+	maxSpeed       = 16.0
+)
+
+func (eng *OnScreenEngine) onKey(win *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+	if action != glfw.Press && !(action == glfw.Repeat && key == glfw.KeyRight) {
+		return
+	}
+	switch key {
+	case glfw.KeySpace:
+		eng.paused = !eng.paused
+	case glfw.KeyRight:
+		eng.paused = true
+		eng.step = true
+	case glfw.KeyHome:
+		eng.time, eng.frame = 0, 0
+	case glfw.KeyUp:
+		if eng.speed < maxSpeed {
+			eng.speed *= 2
+		}
+	case glfw.KeyDown:
+		if eng.speed > minSpeed {
+			eng.speed /= 2
+		}
+	case glfw.KeyF:
+		eng.toggleFullscreen()
+	case glfw.KeyS:
+		if eng.OnScreenshot != nil {
+			eng.OnScreenshot(eng.readTarget(eng.lastTarget))
+		}
+	case glfw.KeyR:
+		eng.toggleRecording()
+	case glfw.KeyH:
+		eng.showStatus = !eng.showStatus
+	}
+}
+
+func (eng *OnScreenEngine) toggleFullscreen() {
+	if eng.window.GetMonitor() != nil {
+		w := eng.windowed
+		eng.window.SetMonitor(nil, w.x, w.y, w.w, w.h, glfw.DontCare)
+		return
+	}
+	eng.windowed.x, eng.windowed.y = eng.window.GetPos()
+	eng.windowed.w, eng.windowed.h = eng.window.GetSize()
+	mode := eng.monitor.GetVideoMode()
+	eng.window.SetMonitor(eng.monitor, 0, 0, mode.Width, mode.Height, mode.RefreshRate)
+}
+
+func (eng *OnScreenEngine) toggleRecording() {
+	if eng.recording != nil {
+		close(eng.recording)
+		eng.recording = nil
+		if eng.droppedFrames > 0 {
+			log.Printf("Dropped %d frames while recording", eng.droppedFrames)
+		}
+		return
+	}
+	if eng.OnRecord == nil {
+		return
+	}
+	recording, err := eng.OnRecord(recordInterval)
+	if err != nil {
+		log.Printf("Unable to start recording: %v", err)
+		return
+	}
+	eng.recording = recording
+	eng.recordedFrames, eng.droppedFrames = 0, 0
+}
+
+// record sends the frame in the target to the recording. The frame is dropped
+// if the recording can not keep up.
+func (eng *OnScreenEngine) record(target int) {
+	select {
+	case eng.recording <- eng.readTarget(target):
+		eng.recordedFrames++
+	default:
+		eng.droppedFrames++
+	}
+}
+
+// readTarget reads the frame in a target back into an image.
+func (eng *OnScreenEngine) readTarget(target int) *image.RGBA {
+	w, h := eng.targetWidth, eng.targetHeight
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	gl.BindFramebuffer(gl.FRAMEBUFFER, eng.targets[target].fbo)
+	gl.ReadPixels(0, 0, int32(w), int32(h), gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(&img.Pix[0]))
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	return img
+}
+
+func (eng *OnScreenEngine) statusText() string {
+	state := "PLAY"
+	if eng.paused {
+		state = "PAUSE"
+	}
+	text := fmt.Sprintf("%s T=%.2f F=%d X%g %.0fFPS", state, eng.time.Seconds(), eng.frame, eng.speed, eng.fps)
+	if eng.recording != nil {
+		text += fmt.Sprintf(" REC %d", eng.recordedFrames)
+		if eng.droppedFrames > 0 {
+			text += fmt.Sprintf(" -%d", eng.droppedFrames)
+		}
+	}
+	return text
+}
+
+// drawStatus draws the status line in the top left corner of the window. The
+// copy program must be in use.
+func (eng *OnScreenEngine) drawStatus(width, height int) {
+	text := eng.statusText()
+	s := &eng.status
+	if s.tex == 0 {
+		gl.GenTextures(1, &s.tex)
+		gl.BindTexture(gl.TEXTURE_2D, s.tex)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	}
+	gl.BindTexture(gl.TEXTURE_2D, s.tex)
+	if text != s.text {
+		img := drawStatusText(text, 2)
+		s.text, s.w, s.h = text, img.Rect.Dx(), img.Rect.Dy()
+		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(s.w), int32(s.h), 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(&img.Pix[0]))
+	}
+
+	const margin = 8
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	gl.Viewport(margin, int32(height-margin-s.h), int32(s.w), int32(s.h))
+	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+	gl.Viewport(0, 0, int32(width), int32(height))
+	gl.Disable(gl.BLEND)
+}
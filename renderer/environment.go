@@ -107,6 +107,15 @@ type Environment interface {
 	Close() error
 }
 
+// A PreviousFrameEnvironment is an environment that reports whether it uses
+// the previous frame, so a scene that can not provide it as a texture fails to
+// load instead of rendering wrong frames.
+type PreviousFrameEnvironment interface {
+	Environment
+
+	UsesPreviousFrame() bool
+}
+
 type SubEnvironment struct {
 	Environment
 	Width, Height uint
@@ -116,6 +125,9 @@ type RenderState struct {
 	Time            time.Duration
 	Interval        time.Duration
 	FramesProcessed uint64
+	// Date is the wall clock time of the frame. It is the actual time, unless
+	// the clock of the engine is set to follow the animation time.
+	Date time.Time
 
 	CanvasWidth  uint
 	CanvasHeight uint
@@ -127,3 +139,13 @@ type RenderState struct {
 	// SubEnvironments as a textureID.
 	SubBuffers map[string]uint32
 }
+
+// frameDate returns the wall clock time of a frame at the animation time. If
+// epoch is zero, the actual time is returned, otherwise epoch is the date at
+// animation time zero.
+func frameDate(epoch time.Time, t time.Duration) time.Time {
+	if epoch.IsZero() {
+		return time.Now()
+	}
+	return epoch.Add(t)
+}
@@ -7,17 +7,20 @@ import (
 	"image"
 	"io"
 	"log"
+	"math"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unsafe"
 
 	"github.com/go-gl/gl/v3.3-core/gl"
 	"github.com/go-gl/glfw/v3.3/glfw"
 
 	"github.com/billtraill/shady/egl"
+	"github.com/billtraill/shady/hdr"
 )
 
 const (
@@ -41,6 +44,43 @@ const (
 	`)
 )
 
+// downsampleSources returns the program that averages the samples of each
+// pixel with a box filter. It is written in the GLSL version of the context
+// and draws the quad of the shader with its vert attribute, so it works with
+// contexts older than OpenGL 3.3.
+func downsampleSources(glVersion OpenGLVersion, factor, sampleWidth, sampleHeight uint) map[Stage][]Source {
+	return map[Stage][]Source{
+		StageVertex: {SourceBuf(fmt.Sprintf(`
+			#version %s
+			attribute vec3 vert;
+			void main(void) {
+				gl_Position = vec4(vert, 1.0);
+			}
+		`, glVersion.glslVersion()))},
+		StageFragment: {SourceBuf(fmt.Sprintf(`
+			#version %s
+			uniform sampler2D samples;
+			const int factor = %d;
+			const vec2 size = vec2(%d.0, %d.0);
+			#if __VERSION__ >= 130
+			#define SAMPLE(pos) texelFetch(samples, ivec2(pos), 0)
+			#else
+			#define SAMPLE(pos) texture2D(samples, ((pos) + 0.5) / size)
+			#endif
+			void main(void) {
+				vec2 base = floor(gl_FragCoord.xy) * float(factor);
+				vec4 sum = vec4(0.0);
+				for (int y = 0; y < factor; y++) {
+					for (int x = 0; x < factor; x++) {
+						sum += SAMPLE(base + vec2(float(x), float(y)));
+					}
+				}
+				gl_FragColor = sum / float(factor * factor);
+			}
+		`, glVersion.glslVersion(), factor, sampleWidth, sampleHeight))},
+	}
+}
+
 const (
 	OpenGL20 OpenGLVersion = 20
 	OpenGL21 OpenGLVersion = 21
@@ -50,6 +90,65 @@ const (
 	OpenGL33 OpenGLVersion = 33
 )
 
+// PixelFormat is the format of the render targets of a Shader and the images
+// it produces.
+type PixelFormat int
+
+const (
+	// RGBA8 renders with 8 bits per channel to *image.RGBA images.
+	RGBA8 PixelFormat = iota
+	// RGBA16F renders with half floats to *hdr.RGBA images.
+	RGBA16F
+	// RGBA32F renders with single precision floats to *hdr.RGBA images.
+	RGBA32F
+)
+
+// ParsePixelFormat parses the name of a pixel format, e.g. "rgba16f".
+func ParsePixelFormat(s string) (PixelFormat, error) {
+	switch strings.ToLower(s) {
+	case "rgba8":
+		return RGBA8, nil
+	case "rgba16f":
+		return RGBA16F, nil
+	case "rgba32f":
+		return RGBA32F, nil
+	}
+	return 0, fmt.Errorf("invalid pixel format: %q", s)
+}
+
+func (pf PixelFormat) String() string {
+	switch pf {
+	case RGBA8:
+		return "rgba8"
+	case RGBA16F:
+		return "rgba16f"
+	case RGBA32F:
+		return "rgba32f"
+	}
+	return "invalid"
+}
+
+// glFormat returns the internal format of render targets and the type and
+// size in bytes of a pixel when reading them back.
+func (pf PixelFormat) glFormat() (internalFormat int32, xtype uint32, bytesPerPixel int) {
+	switch pf {
+	case RGBA16F:
+		return gl.RGBA16F, gl.FLOAT, 16
+	case RGBA32F:
+		return gl.RGBA32F, gl.FLOAT, 16
+	default:
+		return gl.RGBA8, gl.UNSIGNED_BYTE, 4
+	}
+}
+
+// newImage returns an image that can hold pixels of the format.
+func (pf PixelFormat) newImage(rect image.Rectangle) image.Image {
+	if pf == RGBA8 {
+		return image.NewRGBA(rect)
+	}
+	return hdr.NewRGBA(rect)
+}
+
 var ErrWindowClosed = errors.New("window closed")
 
 var initGLOnce sync.Once
@@ -60,7 +159,7 @@ func initEGL(glVersion OpenGLVersion) error {
 		log.Printf("initEGL  egl.GetDisplay: %v  ", err)
 		return err
 	}
-	surface, err := display.CreateSurface(1<<12, 1<<12)
+	surface, err := display.CreateSurface(MaxTileSize, MaxTileSize)
 	if err != nil {
 		log.Printf("initEGL  display.CreateSurface: %v  ", err)
 		return err
@@ -99,8 +198,9 @@ func initOpenGL() error {
 }
 
 type Shader struct {
-	w, h      uint
-	glVersion OpenGLVersion
+	w, h        uint
+	pixelFormat PixelFormat
+	glVersion   OpenGLVersion
 
 	vertLoc uint32
 	vao     uint32
@@ -117,10 +217,58 @@ type Shader struct {
 
 	time            time.Duration
 	frame           uint64
+	epoch           time.Time
 	prevFrameHandle interface{}
+
+	// The state that is exposed by Control.
+	controls  controlQueue
+	paused    bool
+	fps       float64
+	errors    int
+	lastError error
+}
+
+func NewShader(width, height uint, pixelFormat PixelFormat, glVersion OpenGLVersion) (*Shader, error) {
+	return NewShaderWithOptions(width, height, ShaderOptions{PixelFormat: pixelFormat}, glVersion)
+}
+
+// ShaderOptions configure how a Shader renders its images.
+type ShaderOptions struct {
+	PixelFormat PixelFormat
+
+	// TileSize is the largest width and height that is rendered at once.
+	// Larger scenes are rendered in multiple tiles. If 0 or larger than
+	// MaxTileSize, MaxTileSize is used.
+	//
+	// iResolution is the full size of the scene for every tile, but the
+	// environment must support tiles by adding TileOffsetUniform to
+	// gl_FragCoord. Tiles are stitched together before they are used as the
+	// previous frame.
+	TileSize uint
+
+	// Supersample draws the scene this many times wider and higher than the
+	// image and averages the samples of each pixel to reduce aliasing. The
+	// environment sees the size of the scene as the canvas size, so shaders
+	// that are relative to iResolution look the same. 0 and 1 disable
+	// supersampling.
+	Supersample uint
 }
 
-func NewShader(width, height uint, glVersion OpenGLVersion) (*Shader, error) {
+// NewShaderWithOptions is like NewShader, but allows the images to be
+// rendered in tiles or supersampled.
+func NewShaderWithOptions(width, height uint, opts ShaderOptions, glVersion OpenGLVersion) (*Shader, error) {
+	supersample := opts.Supersample
+	if supersample == 0 {
+		supersample = 1
+	}
+	tileSize := opts.TileSize
+	if tileSize == 0 || tileSize > MaxTileSize {
+		tileSize = MaxTileSize
+	}
+	if tileSize < supersample {
+		return nil, fmt.Errorf("the tile size of %d is smaller than the supersampling factor of %d", tileSize, supersample)
+	}
+
 	// Hack: Unit tests require a different style of initialization. We'll
 	// detect whether we are running as a test for now.
 	var err error
@@ -143,12 +291,18 @@ func NewShader(width, height uint, glVersion OpenGLVersion) (*Shader, error) {
 		return nil, err
 	}
 
+	var renderer imageRenderer = &pboRenderer{w: width, h: height, format: opts.PixelFormat, supersample: supersample, glVersion: glVersion}
+	if width*supersample > tileSize || height*supersample > tileSize {
+		renderer = newTiledRenderer(width, height, tileSize/supersample, supersample, opts.PixelFormat, glVersion)
+	}
 	sh := &Shader{
-		w:         width,
-		h:         height,
-		glVersion: glVersion,
-		renderer:  &pboRenderer{w: width, h: height},
-		newEnvs:   make(chan Environment, 1),
+		w:           width * supersample,
+		h:           height * supersample,
+		pixelFormat: opts.PixelFormat,
+		glVersion:   glVersion,
+		renderer:    renderer,
+		newEnvs:     make(chan Environment, 1),
+		controls:    newControlQueue(),
 	}
 
 	// Set up the render targets.
@@ -163,14 +317,27 @@ func NewShader(width, height uint, glVersion OpenGLVersion) (*Shader, error) {
 // reloadEnvironment ensures that an environment is set and set up for
 // rendering.
 func (sh *Shader) reloadEnvironment(ctx context.Context) error {
+	if tr, ok := sh.env.(Transition); ok && tr.Done() {
+		if err := sh.finishTransition(); err != nil {
+			return err
+		}
+	}
+
 	var env Environment
 	if sh.env == nil {
 		// If no environment is set, block until it is set or the context is
-		// canceled.
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case env = <-sh.newEnvs:
+		// canceled. Controls are applied while waiting, so the engine can
+		// be inspected after an environment failed to set up.
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case env = <-sh.newEnvs:
+				break wait
+			case c := <-sh.controls:
+				c.apply(sh.controlState, sh.setControlState)
+			}
 		}
 	} else {
 		// If an environment is already set, check if a newer environment is
@@ -182,12 +349,39 @@ func (sh *Shader) reloadEnvironment(ctx context.Context) error {
 		}
 	}
 
+	// A transition starts from the environment that is rendered, which
+	// may be the target of a transition that is still in progress.
+	var from *Shader
+	if tr, ok := env.(Transition); ok {
+		if _, ok := sh.env.(Transition); ok {
+			if err := sh.finishTransition(); err != nil {
+				log.Printf("Error finishing transition: %v", err)
+			}
+		}
+		if sh.env != nil {
+			var err error
+			if from, err = sh.detachEnvironment(); err != nil {
+				log.Printf("Unable to transition: %v", err)
+			}
+		}
+		if from == nil {
+			env = tr.To()
+		}
+	}
+
 	// Close the old environment if there is one.
 	if sh.env != nil {
 		sh.env.Close()
 		gl.DeleteProgram(sh.program)
 		sh.env = nil
 	}
+	for _, s := range sh.subTargets {
+		s.Close()
+	}
+	sh.subTargets = map[string]*Shader{}
+	if from != nil {
+		sh.subTargets[TransitionFrom] = from
+	}
 	if env == nil {
 		return nil
 	}
@@ -195,6 +389,7 @@ func (sh *Shader) reloadEnvironment(ctx context.Context) error {
 	renderState := RenderState{
 		Time:            sh.time,
 		FramesProcessed: sh.frame,
+		Date:            frameDate(sh.epoch, sh.time),
 		CanvasWidth:     sh.w,
 		CanvasHeight:    sh.h,
 		Uniforms:        sh.uniforms,
@@ -207,14 +402,14 @@ func (sh *Shader) reloadEnvironment(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	sh.subTargets = map[string]*Shader{}
 	for name, env := range subEnvs {
-		s, err := NewShader(env.Width, env.Height, sh.glVersion)
+		s, err := sh.newSubShader(name, env.Width, env.Height)
 		if err != nil {
 			return err
 		}
 		s.SetEnvironment(env.Environment)
 		if err := s.reloadEnvironment(context.Background()); err != nil {
+			s.Close()
 			return err
 		}
 		sh.subTargets[name] = s
@@ -231,15 +426,65 @@ func (sh *Shader) reloadEnvironment(ctx context.Context) error {
 	gl.UseProgram(sh.program)
 	sh.uniforms = ListUniforms(sh.program)
 	sh.vertLoc = uint32(gl.GetAttribLocation(sh.program, gl.Str("vert\x00")))
+	if err := sh.bindTileOffset(env); err != nil {
+		return err
+	}
 
 	sh.env = env
 	return nil
 }
 
+// newSubShader creates a shader that renders a buffer of this shader.
+func (sh *Shader) newSubShader(name string, width, height uint) (*Shader, error) {
+	s, err := NewShader(width, height, sh.pixelFormat, sh.glVersion)
+	if err != nil {
+		return nil, err
+	}
+	if tr, ok := s.renderer.(*tiledRenderer); ok {
+		if err := tr.textureErr(); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("buffer %s: %w", name, err)
+		}
+	}
+	s.time, s.frame, s.epoch = sh.time, sh.frame, sh.epoch
+	return s, nil
+}
+
+// bindTileOffset looks up the uniform that tiles are offset with if the scene
+// is rendered in tiles. An error is returned if the environment uses the
+// previous frame, but the stitched tiles can not be used as a texture.
+func (sh *Shader) bindTileOffset(env Environment) error {
+	tr, ok := sh.renderer.(*tiledRenderer)
+	if !ok {
+		return nil
+	}
+	if pf, ok := env.(PreviousFrameEnvironment); ok && pf.UsesPreviousFrame() {
+		if err := tr.textureErr(); err != nil {
+			return fmt.Errorf("the previous frame is not available: %w", err)
+		}
+	}
+	loc, ok := sh.uniforms[TileOffsetUniform]
+	if !ok {
+		return fmt.Errorf("the environment does not support tiled rendering, which is required for a scene of %dx%d", sh.w, sh.h)
+	}
+	tr.offsetLoc = loc.Location
+	return nil
+}
+
 func (sh *Shader) SetEnvironment(env Environment) {
 	sh.newEnvs <- env
 }
 
+// SetClock sets the animation time of the next frame, so an animation can be
+// started at any point. If epoch is not zero, the date of frames follows the
+// animation time with epoch as the date at time zero, so renders are
+// reproducible. Otherwise, frames are dated with the actual time.
+//
+// SetClock must be called before the environment is set up.
+func (sh *Shader) SetClock(start time.Duration, epoch time.Time) {
+	sh.time, sh.epoch = start, epoch
+}
+
 func (sh *Shader) nextHandle(interval time.Duration) interface{} {
 	if err := sh.reloadEnvironment(context.Background()); err != nil {
 		log.Printf("Error reloading environment: %v", err)
@@ -280,6 +525,7 @@ func (sh *Shader) nextHandle(interval time.Duration) interface{} {
 		Time:               sh.time,
 		Interval:           interval,
 		FramesProcessed:    sh.frame,
+		Date:               frameDate(sh.epoch, sh.time),
 		CanvasWidth:        sh.w,
 		CanvasHeight:       sh.h,
 		Uniforms:           sh.uniforms,
@@ -298,17 +544,34 @@ func (sh *Shader) nextHandle(interval time.Duration) interface{} {
 }
 
 func (sh *Shader) Animate(ctx context.Context, interval time.Duration, stream chan<- image.Image) {
+	if sh.frame == 0 && interval > 0 {
+		// Number the frames as if the animation started at time zero.
+		sh.frame = uint64(sh.time / interval)
+	}
 	buffer := make(chan interface{}, sh.renderer.NumBuffers())
+	fpsStart, fpsFrames := time.Now(), 0
 	for {
 		if err := sh.reloadEnvironment(ctx); errors.Is(err, context.Canceled) {
 			return
 		} else if err != nil {
 			log.Printf("Error reloading environment: %v", err)
+			sh.errors, sh.lastError = sh.errors+1, err
 			continue
 		}
-
-		handle := sh.nextHandle(interval)
-		buffer <- handle
+		sh.controls.apply(sh.controlState, sh.setControlState)
+
+		// A paused animation keeps rendering frames at the same time, so
+		// outputs keep receiving them.
+		if sh.paused {
+			buffer <- sh.nextHandle(0)
+		} else {
+			buffer <- sh.nextHandle(interval)
+		}
+		fpsFrames++
+		if now := time.Now(); now.Sub(fpsStart) >= time.Second/2 {
+			sh.fps = float64(fpsFrames) / now.Sub(fpsStart).Seconds()
+			fpsStart, fpsFrames = now, 0
+		}
 
 		if len(buffer) != cap(buffer) {
 			// Give the first renders time to complete.
@@ -368,23 +631,91 @@ type OnScreenEngine struct {
 
 	time  time.Duration
 	frame uint64
+	epoch time.Time
+
+	window  *glfw.Window
+	monitor *glfw.Monitor
+	opts    WindowOptions
+
+	// targetWidth and targetHeight are the size of the rendered image, which
+	// is scaled to the window.
+	targetWidth, targetHeight int
+
+	// OnScreenshot is called with the current frame when a screenshot is
+	// requested with the keyboard.
+	OnScreenshot func(img image.Image)
+	// OnRecord is called when recording is started with the keyboard.
+	// Displayed frames are sent to the returned channel until recording is
+	// stopped, which closes the channel. Frames are dropped if the channel
+	// is full.
+	OnRecord func(interval time.Duration) (chan<- image.Image, error)
+
+	// The state of the keyboard controls, see OnScreenKeys, and of Control.
+	controls       controlQueue
+	errors         int
+	lastError      error
+	paused, step   bool
+	speed          float64
+	showStatus     bool
+	lastTarget     int
+	recording      chan<- image.Image
+	recordedFrames int
+	droppedFrames  int
+	fps            float64
+	windowed       struct{ x, y, w, h int }
+	status         struct {
+		text string
+		tex  uint32
+		w, h int
+	}
 
-	window *glfw.Window
+	// warnedTransition is set once it was logged that transitions are
+	// skipped.
+	warnedTransition bool
 }
 
-func NewOnScreenEngine(glVersion OpenGLVersion) (*OnScreenEngine, error) {
+// NewOnScreenEngine opens a window as configured by opts.
+func NewOnScreenEngine(glVersion OpenGLVersion, opts WindowOptions) (*OnScreenEngine, error) {
+	if opts.Width <= 0 || opts.Height <= 0 {
+		opts.Width, opts.Height = 1366, 768
+	}
 	if err := glfw.Init(); err != nil {
 		return nil, err
 	}
+	monitor, err := findMonitor(opts.Monitor)
+	if err != nil {
+		glfw.Terminate()
+		return nil, err
+	}
 
 	maj, min := glVersion.majorMinor()
 	glfw.WindowHint(glfw.ContextVersionMajor, maj)
 	glfw.WindowHint(glfw.ContextVersionMinor, min)
-	window, err := glfw.CreateWindow(1366, 768, "Shady", nil, nil)
+	if opts.Borderless {
+		glfw.WindowHint(glfw.Decorated, glfw.False)
+	}
+	var window *glfw.Window
+	if opts.Fullscreen {
+		mode := monitor.GetVideoMode()
+		window, err = glfw.CreateWindow(mode.Width, mode.Height, "Shady", monitor, nil)
+	} else {
+		window, err = glfw.CreateWindow(opts.Width, opts.Height, "Shady", nil, nil)
+	}
 	if err != nil {
 		glfw.Terminate()
 		return nil, err
 	}
+	// Positions are relative to the monitor. Without a position, a window
+	// on another than the primary monitor is centered on it.
+	mx, my := monitor.GetPos()
+	x, y := opts.X, opts.Y
+	if !opts.Positioned {
+		mode := monitor.GetVideoMode()
+		x, y = (mode.Width-opts.Width)/2, (mode.Height-opts.Height)/2
+	}
+	if !opts.Fullscreen && (opts.Positioned || opts.Monitor != "") {
+		window.SetPos(mx+x, my+y)
+	}
 	window.MakeContextCurrent()
 
 	if err := initOpenGL(); err != nil {
@@ -392,15 +723,32 @@ func NewOnScreenEngine(glVersion OpenGLVersion) (*OnScreenEngine, error) {
 		glfw.Terminate()
 		return nil, err
 	}
+	if opts.VSync {
+		glfw.SwapInterval(1)
+	} else {
+		glfw.SwapInterval(0)
+	}
 
 	eng := &OnScreenEngine{
-		newEnvs: make(chan Environment, 1),
-		window:  window,
+		newEnvs:    make(chan Environment, 1),
+		controls:   newControlQueue(),
+		window:     window,
+		monitor:    monitor,
+		opts:       opts,
+		speed:      1,
+		showStatus: true,
 	}
+	eng.windowed.x, eng.windowed.y = mx+x, my+y
+	eng.windowed.w, eng.windowed.h = opts.Width, opts.Height
+	window.SetKeyCallback(eng.onKey)
 
-	w, h := eng.window.GetFramebufferSize()
-	eng.onResize(window, w, h)
-	window.SetSizeCallback(eng.onResize)
+	if opts.RenderWidth > 0 && opts.RenderHeight > 0 {
+		eng.createTargets(int(opts.RenderWidth), int(opts.RenderHeight))
+	} else {
+		w, h := eng.window.GetFramebufferSize()
+		eng.onResize(window, w, h)
+		window.SetFramebufferSizeCallback(eng.onResize)
+	}
 
 	eng.copyProgram, err = linkProgram(map[Stage][]Source{
 		StageVertex:   {textureCopyVert},
@@ -415,6 +763,16 @@ func NewOnScreenEngine(glVersion OpenGLVersion) (*OnScreenEngine, error) {
 }
 
 func (eng *OnScreenEngine) onResize(win *glfw.Window, width int, height int) {
+	if scale := eng.opts.RenderScale; scale > 0 {
+		width = int(math.Max(1, math.Round(float64(width)*scale)))
+		height = int(math.Max(1, math.Round(float64(height)*scale)))
+	}
+	eng.createTargets(width, height)
+}
+
+// createTargets (re)allocates the framebuffers that frames are rendered to.
+func (eng *OnScreenEngine) createTargets(width, height int) {
+	filter := eng.opts.Filter.glFilter()
 	for i := range eng.targets {
 		t := &eng.targets[i]
 		if t.fbo != 0 {
@@ -430,8 +788,8 @@ func (eng *OnScreenEngine) onResize(win *glfw.Window, width int, height int) {
 		gl.BindTexture(gl.TEXTURE_2D, t.tex)
 		zeroes := make([]byte, width*height*3)
 		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGB, int32(width), int32(height), 0, gl.RGB, gl.UNSIGNED_BYTE, gl.Ptr(&zeroes[0]))
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, filter)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, filter)
 		gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, t.tex, 0)
 		if gl.CheckFramebufferStatus(gl.FRAMEBUFFER) != gl.FRAMEBUFFER_COMPLETE {
 			panic(fmt.Errorf("incomplete framebuffer"))
@@ -439,14 +797,20 @@ func (eng *OnScreenEngine) onResize(win *glfw.Window, width int, height int) {
 	}
 	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
 	gl.BindTexture(gl.TEXTURE_2D, 0)
-
-	gl.Viewport(0, 0, int32(width), int32(height))
+	eng.targetWidth, eng.targetHeight = width, height
 }
 
 func (eng *OnScreenEngine) Animate(ctx context.Context) error {
 	lastFrame := time.Now()
 	interval := time.Second / 60
 	i := 0
+	fpsStart, fpsFrames := lastFrame, 0
+	defer func() {
+		if eng.recording != nil {
+			close(eng.recording)
+			eng.recording = nil
+		}
+	}()
 	for {
 		if eng.window.ShouldClose() {
 			return ErrWindowClosed
@@ -459,39 +823,63 @@ func (eng *OnScreenEngine) Animate(ctx context.Context) error {
 			return err
 		} else if err != nil {
 			log.Printf("Error reloading environment: %v", err)
+			eng.errors, eng.lastError = eng.errors+1, err
 			continue
 		}
+		eng.controls.apply(eng.controlState, eng.setControlState)
 
 		gl.BindVertexArray(eng.quadVAO)
 		gl.BindBuffer(gl.ARRAY_BUFFER, eng.quadVBO)
 
-		target := &eng.targets[i%len(eng.targets)]
-		prevTarget := &eng.targets[(i+len(eng.targets)-1)%len(eng.targets)]
-
-		// 1st pass: render the actual image.
-		w, h := eng.window.GetFramebufferSize()
-		gl.BindFramebuffer(gl.FRAMEBUFFER, target.fbo)
-		gl.UseProgram(eng.program)
-		eng.env.PreRender(RenderState{
-			Time:               eng.time,
-			Interval:           interval,
-			FramesProcessed:    eng.frame,
-			CanvasWidth:        uint(w),
-			CanvasHeight:       uint(h),
-			Uniforms:           eng.uniforms,
-			PreviousFrameTexID: func() uint32 { return prevTarget.tex },
-			SubBuffers:         nil, // TODO
-		})
-
-		gl.EnableVertexAttribArray(eng.vertLoc)
-		gl.VertexAttribPointer(eng.vertLoc, 3, gl.FLOAT, false, 0, nil)
-		gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+		// 1st pass: render the actual image, unless paused.
+		if !eng.paused || eng.step {
+			if eng.step {
+				interval = time.Duration(float64(time.Second/60) * eng.speed)
+				eng.step = false
+			}
+			target := &eng.targets[i%len(eng.targets)]
+			prevTarget := &eng.targets[(i+len(eng.targets)-1)%len(eng.targets)]
+			gl.BindFramebuffer(gl.FRAMEBUFFER, target.fbo)
+			gl.Viewport(0, 0, int32(eng.targetWidth), int32(eng.targetHeight))
+			gl.UseProgram(eng.program)
+			eng.env.PreRender(RenderState{
+				Time:               eng.time,
+				Interval:           interval,
+				FramesProcessed:    eng.frame,
+				Date:               frameDate(eng.epoch, eng.time),
+				CanvasWidth:        uint(eng.targetWidth),
+				CanvasHeight:       uint(eng.targetHeight),
+				Uniforms:           eng.uniforms,
+				PreviousFrameTexID: func() uint32 { return prevTarget.tex },
+				SubBuffers:         nil, // TODO
+			})
+
+			gl.EnableVertexAttribArray(eng.vertLoc)
+			gl.VertexAttribPointer(eng.vertLoc, 3, gl.FLOAT, false, 0, nil)
+			gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+
+			eng.lastTarget = i % len(eng.targets)
+			if eng.recording != nil {
+				eng.record(eng.lastTarget)
+			}
+			eng.time += interval
+			eng.frame++
+			i++
+			fpsFrames++
+		}
 
 		// 2nd pass: copy the rendered image to the on-screen framebuffer.
+		w, h := eng.window.GetFramebufferSize()
 		gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+		if eng.opts.Filter == ScaleInteger {
+			gl.ClearColor(0, 0, 0, 1)
+			gl.Clear(gl.COLOR_BUFFER_BIT)
+		}
+		vx, vy, vw, vh := eng.opts.Filter.viewport(w, h, eng.targetWidth, eng.targetHeight)
+		gl.Viewport(int32(vx), int32(vy), int32(vw), int32(vh))
 		gl.UseProgram(eng.copyProgram)
 		gl.ActiveTexture(gl.TEXTURE0)
-		gl.BindTexture(gl.TEXTURE_2D, target.tex)
+		gl.BindTexture(gl.TEXTURE_2D, eng.targets[eng.lastTarget].tex)
 		gl.Uniform1i(
 			gl.GetUniformLocation(eng.copyProgram, gl.Str("screenTexture\x00")),
 			0,
@@ -501,16 +889,27 @@ func (eng *OnScreenEngine) Animate(ctx context.Context) error {
 		gl.EnableVertexAttribArray(loc)
 		gl.VertexAttribPointer(loc, 3, gl.FLOAT, false, 0, nil)
 		gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+		if eng.showStatus {
+			eng.drawStatus(w, h)
+		}
 
 		now := time.Now()
-		interval = now.Sub(lastFrame)
+		interval = time.Duration(float64(now.Sub(lastFrame)) * eng.speed)
 		lastFrame = now
-		eng.time += interval
-		eng.frame++
-		i++
+		if d := now.Sub(fpsStart); d >= time.Second/2 {
+			eng.fps = float64(fpsFrames) / d.Seconds()
+			fpsStart, fpsFrames = now, 0
+		}
 
 		eng.window.SwapBuffers()
-		glfw.PollEvents()
+		if eng.paused && !eng.step {
+			// Nothing is rendered while paused, so wait for input for about
+			// a frame instead of redrawing as fast as possible when vsync is
+			// off.
+			glfw.WaitEventsTimeout((time.Second / 60).Seconds())
+		} else {
+			glfw.PollEvents()
+		}
 	}
 }
 
@@ -524,11 +923,18 @@ func (eng *OnScreenEngine) reloadEnvironment(ctx context.Context) error {
 	var env Environment
 	if eng.env == nil {
 		// If no environment is set, block until it is set or the context is
-		// canceled.
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case env = <-eng.newEnvs:
+		// canceled. Controls are applied while waiting, like in
+		// Shader.reloadEnvironment.
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case env = <-eng.newEnvs:
+				break wait
+			case c := <-eng.controls:
+				c.apply(eng.controlState, eng.setControlState)
+			}
 		}
 	} else {
 		// If an environment is already set, check if a newer environment is
@@ -540,6 +946,15 @@ func (eng *OnScreenEngine) reloadEnvironment(ctx context.Context) error {
 		}
 	}
 
+	// The window can not render buffers, so transitions are skipped.
+	if tr, ok := env.(Transition); ok {
+		if !eng.warnedTransition {
+			log.Printf("Transitions are not supported by the window, switching without them")
+			eng.warnedTransition = true
+		}
+		env = tr.To()
+	}
+
 	// Close the old environment if there is one.
 	if eng.env != nil {
 		eng.env.Close()
@@ -550,12 +965,12 @@ func (eng *OnScreenEngine) reloadEnvironment(ctx context.Context) error {
 		return nil
 	}
 
-	w, h := eng.window.GetFramebufferSize()
 	renderState := RenderState{
 		Time:            eng.time,
 		FramesProcessed: eng.frame,
-		CanvasWidth:     uint(w),
-		CanvasHeight:    uint(h),
+		Date:            frameDate(eng.epoch, eng.time),
+		CanvasWidth:     uint(eng.targetWidth),
+		CanvasHeight:    uint(eng.targetHeight),
 		Uniforms:        eng.uniforms,
 	}
 	if err := env.Setup(renderState); err != nil {
@@ -568,10 +983,11 @@ func (eng *OnScreenEngine) reloadEnvironment(ctx context.Context) error {
 	}
 	eng.subTargets = map[string]*Shader{}
 	for name, env := range subEnvs {
-		s, err := NewShader(env.Width, env.Height, eng.glVersion)
+		s, err := NewShader(env.Width, env.Height, RGBA8, eng.glVersion)
 		if err != nil {
 			return err
 		}
+		s.time, s.frame, s.epoch = eng.time, eng.frame, eng.epoch
 		s.SetEnvironment(env.Environment)
 		if err := s.reloadEnvironment(context.Background()); err != nil {
 			return err
@@ -599,6 +1015,11 @@ func (eng *OnScreenEngine) SetEnvironment(env Environment) {
 	eng.newEnvs <- env
 }
 
+// SetClock is like Shader.SetClock.
+func (eng *OnScreenEngine) SetClock(start time.Duration, epoch time.Time) {
+	eng.time, eng.epoch = start, epoch
+}
+
 type renderer interface {
 	io.Closer
 	Setup() error
@@ -614,23 +1035,51 @@ type imageRenderer interface {
 }
 
 type pboRenderer struct {
-	w, h           uint
-	curTargetIndex int
-	targets        [3]struct {
+	w, h   uint
+	format PixelFormat
+	// supersample is the factor by which the scene is drawn larger than the
+	// image if greater than 1.
+	supersample       uint
+	glVersion         OpenGLVersion
+	downsampleProgram uint32
+	downsampleVertLoc uint32
+	curTargetIndex    int
+	targets           [3]struct {
 		pbo, rbo, fbo uint32
+		// sampleFBO and sampleTex hold the supersampled scene, which is
+		// kept so it can be used as the previous frame.
+		sampleFBO, sampleTex uint32
 	}
 }
 
 func (pr *pboRenderer) Setup() error {
+	internalFormat, xtype, bytesPerPixel := pr.format.glFormat()
 	for i := range pr.targets {
 		t := &pr.targets[i]
+		if pr.supersample > 1 {
+			gl.GenTextures(1, &t.sampleTex)
+			gl.BindTexture(gl.TEXTURE_2D, t.sampleTex)
+			gl.TexImage2D(gl.TEXTURE_2D, 0, internalFormat, int32(pr.w*pr.supersample), int32(pr.h*pr.supersample), 0, gl.RGBA, xtype, nil)
+			gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+			gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+			gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+			gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+			gl.GenFramebuffers(1, &t.sampleFBO)
+			gl.BindFramebuffer(gl.FRAMEBUFFER, t.sampleFBO)
+			gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, t.sampleTex, 0)
+			if gl.CheckFramebufferStatus(gl.FRAMEBUFFER) != gl.FRAMEBUFFER_COMPLETE {
+				return fmt.Errorf("incomplete supersampling framebuffer")
+			}
+			gl.BindTexture(gl.TEXTURE_2D, 0)
+		}
+
 		// Framebuffer.
 		gl.GenFramebuffers(1, &t.fbo)
 		gl.BindFramebuffer(gl.FRAMEBUFFER, t.fbo)
 		// Color renderbuffer.
 		gl.GenRenderbuffers(1, &t.rbo)
 		gl.BindRenderbuffer(gl.RENDERBUFFER, t.rbo)
-		gl.RenderbufferStorage(gl.RENDERBUFFER, gl.RGBA8, int32(pr.w), int32(pr.h))
+		gl.RenderbufferStorage(gl.RENDERBUFFER, uint32(internalFormat), int32(pr.w), int32(pr.h))
 
 		gl.FramebufferRenderbuffer(gl.DRAW_FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.RENDERBUFFER, t.rbo)
 		gl.PixelStorei(gl.UNPACK_ALIGNMENT, 4)
@@ -639,11 +1088,23 @@ func (pr *pboRenderer) Setup() error {
 		// Pixelbuffer
 		gl.GenBuffers(1, &t.pbo)
 		gl.BindBuffer(gl.PIXEL_PACK_BUFFER, t.pbo)
-		gl.BufferData(gl.PIXEL_PACK_BUFFER, int(pr.w*pr.h*4), nil, gl.DYNAMIC_READ)
+		gl.BufferData(gl.PIXEL_PACK_BUFFER, int(pr.w*pr.h)*bytesPerPixel, nil, gl.DYNAMIC_READ)
 	}
 	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
 	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, 0)
 	gl.BindRenderbuffer(gl.RENDERBUFFER, 0)
+
+	if pr.supersample > 1 {
+		var err error
+		pr.downsampleProgram, err = linkProgram(downsampleSources(pr.glVersion, pr.supersample, pr.w*pr.supersample, pr.h*pr.supersample))
+		if err != nil {
+			return err
+		}
+		pr.downsampleVertLoc = uint32(gl.GetAttribLocation(pr.downsampleProgram, gl.Str("vert\x00")))
+		gl.UseProgram(pr.downsampleProgram)
+		gl.Uniform1i(gl.GetUniformLocation(pr.downsampleProgram, gl.Str("samples\x00")), 0)
+		gl.UseProgram(0)
+	}
 	return nil
 }
 
@@ -652,43 +1113,101 @@ func (pr *pboRenderer) NumBuffers() int {
 }
 
 func (pr *pboRenderer) Image(handle interface{}) image.Image {
-	i := handle.(int)
-	img := image.NewRGBA(image.Rect(0, 0, int(pr.w), int(pr.h)))
-	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, pr.targets[i].pbo)
-	gl.GetBufferSubData(gl.PIXEL_PACK_BUFFER, 0, int(pr.w*pr.h*4), gl.Ptr(&img.Pix[0]))
-	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, 0)
+	rect := image.Rect(0, 0, int(pr.w), int(pr.h))
+	img := pr.format.newImage(rect)
+	pr.readInto(handle, img, rect)
 	return img
 }
 
+// readInto copies the pixels of the target of the handle in rect into the same
+// area of img, which must have been created by the pixel format of the
+// renderer. The pixels are read from the lower left of the target, so rect may
+// be larger than the target.
+func (pr *pboRenderer) readInto(handle interface{}, img image.Image, rect image.Rectangle) {
+	_, _, bytesPerPixel := pr.format.glFormat()
+	var ptr func(x, y int) unsafe.Pointer
+	switch img := img.(type) {
+	case *image.RGBA:
+		ptr = func(x, y int) unsafe.Pointer { return gl.Ptr(&img.Pix[img.PixOffset(x, y)]) }
+	case *hdr.RGBA:
+		ptr = func(x, y int) unsafe.Pointer { return gl.Ptr(&img.Pix[img.PixOffset(x, y)]) }
+	}
+	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, pr.targets[handle.(int)].pbo)
+	if rect.Dx() == int(pr.w) && rect.Dx() == img.Bounds().Dx() {
+		gl.GetBufferSubData(gl.PIXEL_PACK_BUFFER, 0, rect.Dx()*rect.Dy()*bytesPerPixel, ptr(rect.Min.X, rect.Min.Y))
+	} else {
+		for y := 0; y < rect.Dy(); y++ {
+			gl.GetBufferSubData(gl.PIXEL_PACK_BUFFER, y*int(pr.w)*bytesPerPixel, rect.Dx()*bytesPerPixel, ptr(rect.Min.X, rect.Min.Y+y))
+		}
+	}
+	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, 0)
+}
+
 // Draw instructs OpenGL to render a single image with the scene drawn by
 // function provided.
 // A handle is returned which can be used to access the image data.
 func (pr *pboRenderer) Draw(drawFunc func()) interface{} {
 	pr.curTargetIndex = (pr.curTargetIndex + 1) % len(pr.targets)
 	t := &pr.targets[pr.curTargetIndex]
-	gl.BindFramebuffer(gl.FRAMEBUFFER, t.fbo)
-	gl.Clear(gl.COLOR_BUFFER_BIT)
-	drawFunc()
+	if pr.supersample > 1 {
+		gl.BindFramebuffer(gl.FRAMEBUFFER, t.sampleFBO)
+		gl.Clear(gl.COLOR_BUFFER_BIT)
+		drawFunc()
+		gl.BindFramebuffer(gl.FRAMEBUFFER, t.fbo)
+		pr.downsample(t.sampleTex)
+	} else {
+		gl.BindFramebuffer(gl.FRAMEBUFFER, t.fbo)
+		gl.Clear(gl.COLOR_BUFFER_BIT)
+		drawFunc()
+	}
 	// Start the transfer of the image to the PBO.
+	_, xtype, _ := pr.format.glFormat()
 	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, t.pbo)
-	gl.ReadPixels(0, 0, int32(pr.w), int32(pr.h), gl.RGBA, gl.UNSIGNED_BYTE, nil)
+	gl.ReadPixels(0, 0, int32(pr.w), int32(pr.h), gl.RGBA, xtype, nil)
 	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
 	return pr.curTargetIndex
 }
 
+// downsample draws the average of the samples of each pixel in the texture to
+// the bound framebuffer using the quad in the bound vertex buffer. The state
+// that is needed to draw the scene again is restored afterwards.
+func (pr *pboRenderer) downsample(sampleTex uint32) {
+	var program, activeTexture, boundTexture int32
+	gl.GetIntegerv(gl.CURRENT_PROGRAM, &program)
+	gl.GetIntegerv(gl.ACTIVE_TEXTURE, &activeTexture)
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.GetIntegerv(gl.TEXTURE_BINDING_2D, &boundTexture)
+
+	gl.UseProgram(pr.downsampleProgram)
+	gl.BindTexture(gl.TEXTURE_2D, sampleTex)
+	gl.EnableVertexAttribArray(pr.downsampleVertLoc)
+	gl.VertexAttribPointer(pr.downsampleVertLoc, 3, gl.FLOAT, false, 0, nil)
+	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+
+	gl.BindTexture(gl.TEXTURE_2D, uint32(boundTexture))
+	gl.ActiveTexture(uint32(activeTexture))
+	gl.UseProgram(uint32(program))
+}
+
 func (pr *pboRenderer) Texture(handle interface{}) (uint32, func()) {
 	t := pr.targets[handle.(int)]
+	if pr.supersample > 1 {
+		// The supersampled scene is the previous frame as the environment
+		// knows it. It is left alone until the target is drawn again.
+		return t.sampleTex, func() {}
+	}
+	internalFormat, xtype, _ := pr.format.glFormat()
 	var tex uint32
 	gl.GenTextures(1, &tex)
 	gl.BindTexture(gl.TEXTURE_2D, tex)
-	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(pr.w), int32(pr.h), 0, gl.RGBA, gl.UNSIGNED_BYTE, nil)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, internalFormat, int32(pr.w), int32(pr.h), 0, gl.RGBA, xtype, nil)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
 
 	gl.BindBuffer(gl.PIXEL_UNPACK_BUFFER, t.pbo)
-	gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, int32(pr.w), int32(pr.h), gl.RGBA, gl.UNSIGNED_BYTE, nil)
+	gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, int32(pr.w), int32(pr.h), gl.RGBA, xtype, nil)
 	gl.BindBuffer(gl.PIXEL_UNPACK_BUFFER, 0)
 	gl.BindTexture(gl.TEXTURE_2D, 0)
 	return tex, func() {
@@ -701,6 +1220,13 @@ func (pr *pboRenderer) Close() error {
 		gl.DeleteFramebuffers(1, &t.fbo)
 		gl.DeleteRenderbuffers(1, &t.rbo)
 		gl.DeleteBuffers(1, &t.pbo)
+		if pr.supersample > 1 {
+			gl.DeleteFramebuffers(1, &t.sampleFBO)
+			gl.DeleteTextures(1, &t.sampleTex)
+		}
+	}
+	if pr.supersample > 1 {
+		gl.DeleteProgram(pr.downsampleProgram)
 	}
 	return nil
 }
@@ -743,6 +1269,24 @@ func OpenGLVersionFromGLSLVersion(s string) (OpenGLVersion, error) {
 	return OpenGLVersion(glslVersion / 10), nil
 }
 
+// glslVersion returns the GLSL version of the OpenGL version, see
+// OpenGLVersionFromGLSLVersion.
+func (v OpenGLVersion) glslVersion() string {
+	switch v {
+	case OpenGL20:
+		return "110"
+	case OpenGL21:
+		return "120"
+	case OpenGL30:
+		return "130"
+	case OpenGL31:
+		return "140"
+	case OpenGL32:
+		return "150"
+	}
+	return strconv.Itoa(int(v) * 10)
+}
+
 func (v OpenGLVersion) String() string {
 	maj, min := v.majorMinor()
 	return fmt.Sprintf("%d.%d", maj, min)
@@ -0,0 +1,88 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"unicode"
+)
+
+// statusGlyphs is a 3x5 pixel font for the status line of the OnScreenEngine.
+// Each glyph is listed row by row, '#' marks a set pixel. Lower case letters
+// are drawn as upper case.
+var statusGlyphs = map[rune]string{
+	'0': "####.##.##.####",
+	'1': ".#.##..#..#.###",
+	'2': "###..#####..###",
+	'3': "###..#.##..####",
+	'4': "#.##.####..#..#",
+	'5': "####..###..####",
+	'6': "####..####.####",
+	'7': "###..#..#.#..#.",
+	'8': "####.#####.####",
+	'9': "####.####..####",
+	'A': ".#.#.#####.##.#",
+	'B': "##.#.###.#.###.",
+	'C': ".###..#..#...##",
+	'D': "##.#.##.##.###.",
+	'E': "####..##.#..###",
+	'F': "####..##.#..#..",
+	'G': ".###..#.##.#.##",
+	'H': "#.##.#####.##.#",
+	'I': "###.#..#..#.###",
+	'J': "..#..#..##.#.#.",
+	'K': "#.##.###.#.##.#",
+	'L': "#..#..#..#..###",
+	'M': "#.########.##.#",
+	'N': "##.#.##.##.##.#",
+	'O': ".#.#.##.##.#.#.",
+	'P': "##.#.###.#..#..",
+	'Q': ".#.#.##.###..##",
+	'R': "##.#.###.#.##.#",
+	'S': ".###...#...###.",
+	'T': "###.#..#..#..#.",
+	'U': "#.##.##.##.####",
+	'V': "#.##.##.##.#.#.",
+	'W': "#.##.########.#",
+	'X': "#.##.#.#.#.##.#",
+	'Y': "#.##.#.#..#..#.",
+	'Z': "###..#.#.#..###",
+	' ': "...............",
+	'.': ".............#.",
+	':': "....#.....#....",
+	'-': "......###......",
+	'+': "....#.###.#....",
+	'=': "...###...###...",
+	'/': "..#..#.#.#..#..",
+	'%': "#.#..#.#.#..#.#",
+}
+
+// drawStatusText draws a line of text in white on a translucent background.
+// Each pixel of the font is scaled to scale×scale pixels. Characters that are
+// not in the font are drawn as spaces.
+func drawStatusText(text string, scale int) *image.RGBA {
+	const glyphWidth, glyphHeight, padding = 3, 5, 1
+	runes := []rune(text)
+	width := (len(runes)*(glyphWidth+1) - 1 + padding*2) * scale
+	height := (glyphHeight + padding*2) * scale
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Rect, image.NewUniform(color.RGBA{A: 0xa0}), image.Point{}, draw.Src)
+
+	white := image.NewUniform(color.White)
+	for i, r := range runes {
+		glyph, ok := statusGlyphs[unicode.ToUpper(r)]
+		if !ok {
+			continue
+		}
+		x0 := (padding + i*(glyphWidth+1)) * scale
+		for p, c := range glyph {
+			if c != '#' {
+				continue
+			}
+			x := x0 + p%glyphWidth*scale
+			y := (padding + p/glyphWidth) * scale
+			draw.Draw(img, image.Rect(x, y, x+scale, y+scale), white, image.Point{}, draw.Src)
+		}
+	}
+	return img
+}
@@ -0,0 +1,63 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDrawStatusText(t *testing.T) {
+	img := drawStatusText("1a?", 2)
+	// Three glyphs of 3 pixels with a pixel between them and a pixel of
+	// padding around the text.
+	if exp := image.Rect(0, 0, (3*4-1+2)*2, (5+2)*2); img.Rect != exp {
+		t.Fatalf("unexpected size: exp %v, got %v", exp, img.Rect)
+	}
+
+	// Render the set pixels of the font as text, one character per scaled
+	// pixel of the glyphs.
+	var rows []string
+	for y := 2; y < img.Rect.Dy()-2; y += 2 {
+		var row strings.Builder
+		for x := 2; x < img.Rect.Dx()-2; x += 2 {
+			if img.RGBAAt(x, y) == (color.RGBA{0xff, 0xff, 0xff, 0xff}) && img.RGBAAt(x+1, y+1) == (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+				row.WriteByte('#')
+			} else {
+				row.WriteByte('.')
+			}
+		}
+		rows = append(rows, row.String())
+	}
+	exp := []string{
+		".#...#.....",
+		"##..#.#....",
+		".#..###....",
+		".#..#.#....",
+		"###.#.#....",
+	}
+	if strings.Join(rows, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("unexpected glyphs:\n%s", strings.Join(rows, "\n"))
+	}
+	if bg := img.RGBAAt(0, 0); bg != (color.RGBA{A: 0xa0}) {
+		t.Errorf("unexpected background: %v", bg)
+	}
+}
+
+func TestStatusText(t *testing.T) {
+	eng := &OnScreenEngine{time: 1500 * time.Millisecond, frame: 90, speed: 0.5, fps: 59.6}
+	if text := eng.statusText(); text != "PLAY T=1.50 F=90 X0.5 60FPS" {
+		t.Errorf("unexpected status: %q", text)
+	}
+	eng.paused = true
+	eng.recording = make(chan image.Image)
+	eng.recordedFrames = 12
+	if text := eng.statusText(); text != "PAUSE T=1.50 F=90 X0.5 60FPS REC 12" {
+		t.Errorf("unexpected status: %q", text)
+	}
+	eng.droppedFrames = 3
+	if text := eng.statusText(); !strings.HasSuffix(text, " REC 12 -3") {
+		t.Errorf("unexpected status: %q", text)
+	}
+}
@@ -0,0 +1,177 @@
+package renderer
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"unsafe"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/billtraill/shady/hdr"
+)
+
+// MaxTileSize is the largest width and height that can be rendered at once.
+// Larger images are rendered in tiles.
+const MaxTileSize = 1 << 12
+
+// TileOffsetUniform is the name of the vec2 uniform which environments must
+// add to gl_FragCoord to support tiled rendering. It is set to the position of
+// the lower left corner of the tile that is being rendered.
+const TileOffsetUniform = "shadyTileOffset"
+
+// tiledRenderer renders images that are larger than a single render target by
+// drawing the scene once for every tile with a different offset. The tiles are
+// stitched together into an image of the full size.
+//
+// Handles are the stitched images themselves.
+type tiledRenderer struct {
+	w, h   uint
+	format PixelFormat
+	tile   *pboRenderer
+	tiles  []tile
+	// offsetLoc is the location of TileOffsetUniform in the current program.
+	offsetLoc int32
+
+	maxTextureSize int32
+	warnedTexture  bool
+}
+
+// newTiledRenderer returns a renderer for images of width by height pixels in
+// tiles of at most tileSize pixels, which are supersampled by the factor.
+func newTiledRenderer(width, height, tileSize, supersample uint, format PixelFormat, glVersion OpenGLVersion) *tiledRenderer {
+	tileWidth, tileHeight, tiles := tileLayout(width, height, tileSize, supersample)
+	return &tiledRenderer{
+		w:         width,
+		h:         height,
+		format:    format,
+		tile:      &pboRenderer{w: tileWidth, h: tileHeight, format: format, supersample: supersample, glVersion: glVersion},
+		tiles:     tiles,
+		offsetLoc: -1,
+	}
+}
+
+// A tile is an area of the image that is drawn at once.
+type tile struct {
+	// rect is the area of the image that is covered by the tile.
+	rect image.Rectangle
+	// offsetX and offsetY are the position of the tile in the scene, which
+	// is supersampled, and the value of TileOffsetUniform.
+	offsetX, offsetY float32
+}
+
+// tileLayout divides an image of width by height pixels into tiles of at most
+// tileSize pixels. The tiles at the edges are cut off by the image, but are
+// drawn with the full tile size.
+func tileLayout(width, height, tileSize, supersample uint) (tileWidth, tileHeight uint, tiles []tile) {
+	tileWidth, tileHeight = width, height
+	if tileWidth > tileSize {
+		tileWidth = tileSize
+	}
+	if tileHeight > tileSize {
+		tileHeight = tileSize
+	}
+	rect := image.Rect(0, 0, int(width), int(height))
+	for y := 0; y < rect.Dy(); y += int(tileHeight) {
+		for x := 0; x < rect.Dx(); x += int(tileWidth) {
+			tiles = append(tiles, tile{
+				rect:    image.Rect(x, y, x+int(tileWidth), y+int(tileHeight)).Intersect(rect),
+				offsetX: float32(x * int(supersample)),
+				offsetY: float32(y * int(supersample)),
+			})
+		}
+	}
+	return tileWidth, tileHeight, tiles
+}
+
+func (tr *tiledRenderer) Setup() error {
+	gl.GetIntegerv(gl.MAX_TEXTURE_SIZE, &tr.maxTextureSize)
+	return tr.tile.Setup()
+}
+
+func (tr *tiledRenderer) NumBuffers() int {
+	// Tiles are read back before Draw returns, so there is nothing to wait
+	// for.
+	return 1
+}
+
+// textureErr returns an error if the images can not be used as a texture of
+// the scene. The tiles of a supersampled scene are downsampled before they are
+// stitched, so the stitched image is smaller than the scene.
+func (tr *tiledRenderer) textureErr() error {
+	if tr.tile.supersample > 1 {
+		return fmt.Errorf("a supersampled image that is rendered in tiles can not be used as a texture")
+	}
+	if int32(tr.w) > tr.maxTextureSize || int32(tr.h) > tr.maxTextureSize {
+		return fmt.Errorf("an image of %dx%d can not be used as a texture, the maximum size is %d", tr.w, tr.h, tr.maxTextureSize)
+	}
+	return nil
+}
+
+func (tr *tiledRenderer) Draw(drawFunc func()) interface{} {
+	rect := image.Rect(0, 0, int(tr.w), int(tr.h))
+	img := tr.format.newImage(rect)
+
+	type pendingTile struct {
+		handle interface{}
+		rect   image.Rectangle
+	}
+	var pending []pendingTile
+	read := func() {
+		t := pending[0]
+		pending = pending[1:]
+		tr.tile.readInto(t.handle, img, t.rect)
+	}
+	for _, t := range tr.tiles {
+		gl.Uniform2f(tr.offsetLoc, t.offsetX, t.offsetY)
+		handle := tr.tile.Draw(drawFunc)
+		pending = append(pending, pendingTile{handle: handle, rect: t.rect})
+		// Keep the transfers of the other targets of the tile renderer in
+		// flight while drawing the next tile.
+		if len(pending) == tr.tile.NumBuffers() {
+			read()
+		}
+	}
+	for len(pending) > 0 {
+		read()
+	}
+	return img
+}
+
+func (tr *tiledRenderer) Image(handle interface{}) image.Image {
+	return handle.(image.Image)
+}
+
+func (tr *tiledRenderer) Texture(handle interface{}) (uint32, func()) {
+	if err := tr.textureErr(); err != nil {
+		if !tr.warnedTexture {
+			log.Printf("Unable to use the previous frame in a tiled render: %v", err)
+			tr.warnedTexture = true
+		}
+		return 0, func() {}
+	}
+	internalFormat, xtype, _ := tr.format.glFormat()
+	var pix unsafe.Pointer
+	switch img := handle.(type) {
+	case *image.RGBA:
+		pix = gl.Ptr(&img.Pix[0])
+	case *hdr.RGBA:
+		pix = gl.Ptr(&img.Pix[0])
+	}
+	var tex uint32
+	gl.GenTextures(1, &tex)
+	gl.BindTexture(gl.TEXTURE_2D, tex)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, internalFormat, int32(tr.w), int32(tr.h), 0, gl.RGBA, xtype, pix)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return tex, func() {
+		gl.DeleteTextures(1, &tex)
+	}
+}
+
+func (tr *tiledRenderer) Close() error {
+	return tr.tile.Close()
+}
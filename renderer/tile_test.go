@@ -0,0 +1,48 @@
+package renderer
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestTileLayout(t *testing.T) {
+	cases := []struct {
+		width, height, tileSize, supersample uint
+		expW, expH                           uint
+		expTiles                             []tile
+	}{
+		{40, 30, 64, 1, 40, 30, []tile{
+			{image.Rect(0, 0, 40, 30), 0, 0},
+		}},
+		{100, 50, 40, 1, 40, 40, []tile{
+			{image.Rect(0, 0, 40, 40), 0, 0},
+			{image.Rect(40, 0, 80, 40), 40, 0},
+			{image.Rect(80, 0, 100, 40), 80, 0},
+			{image.Rect(0, 40, 40, 50), 0, 40},
+			{image.Rect(40, 40, 80, 50), 40, 40},
+			{image.Rect(80, 40, 100, 50), 80, 40},
+		}},
+		{100, 30, 40, 3, 40, 30, []tile{
+			{image.Rect(0, 0, 40, 30), 0, 0},
+			{image.Rect(40, 0, 80, 30), 120, 0},
+			{image.Rect(80, 0, 100, 30), 240, 0},
+		}},
+		{80, 80, 40, 2, 40, 40, []tile{
+			{image.Rect(0, 0, 40, 40), 0, 0},
+			{image.Rect(40, 0, 80, 40), 80, 0},
+			{image.Rect(0, 40, 40, 80), 0, 80},
+			{image.Rect(40, 40, 80, 80), 80, 80},
+		}},
+	}
+	for _, c := range cases {
+		w, h, tiles := tileLayout(c.width, c.height, c.tileSize, c.supersample)
+		if w != c.expW || h != c.expH {
+			t.Errorf("unexpected tile size for %dx%d in tiles of %d: %dx%d", c.width, c.height, c.tileSize, w, h)
+		}
+		if !reflect.DeepEqual(tiles, c.expTiles) {
+			t.Errorf("unexpected tiles for %dx%d in tiles of %d supersampled by %d:\nexp %v\ngot %v",
+				c.width, c.height, c.tileSize, c.supersample, c.expTiles, tiles)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package renderer
+
+import (
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+const (
+	// TransitionFrom is the name of the sub buffer that the environment that
+	// is transitioned from is rendered to.
+	TransitionFrom = "from"
+	// TransitionTo is the name of the sub buffer that the environment that is
+	// transitioned to is rendered to.
+	TransitionTo = "to"
+)
+
+// A Transition is an environment that blends the environment that is rendered
+// when the transition is set with another environment.
+//
+// The environment that is transitioned from keeps rendering to the sub
+// buffer TransitionFrom. The transition must return the environment that is
+// returned by To as the sub environment TransitionTo. Once the transition is
+// done, the environment it transitioned to replaces it without being set up
+// again.
+//
+// If no environment is rendered, or the engine can not render transitions,
+// the environment returned by To is used directly.
+type Transition interface {
+	Environment
+
+	// To returns the environment that is transitioned to.
+	To() Environment
+	// Done reports whether the last frame showed only the environment that
+	// is transitioned to.
+	Done() bool
+}
+
+// detachEnvironment moves the environment that is rendered to a new shader, so
+// it can keep rendering as a sub buffer while a transition is set up.
+func (sh *Shader) detachEnvironment() (*Shader, error) {
+	s, err := sh.newSubShader(TransitionFrom, sh.w, sh.h)
+	if err != nil {
+		return nil, err
+	}
+	s.env, s.program, s.uniforms, s.vertLoc = sh.env, sh.program, sh.uniforms, sh.vertLoc
+	s.subTargets = sh.subTargets
+	if err := s.bindTileOffset(s.env); err != nil {
+		s.env, s.program, s.subTargets = nil, 0, nil
+		s.Close()
+		return nil, err
+	}
+	// The previous frame of the detached environment is lost, so shaders that
+	// read it see an empty texture for one frame.
+	sh.env, sh.program, sh.uniforms, sh.subTargets = nil, 0, nil, nil
+	return s, nil
+}
+
+// finishTransition replaces the transition that is rendered with the
+// environment that it transitions to.
+func (sh *Shader) finishTransition() error {
+	to := sh.subTargets[TransitionTo]
+	delete(sh.subTargets, TransitionTo)
+
+	sh.env.Close()
+	gl.DeleteProgram(sh.program)
+	for _, s := range sh.subTargets {
+		s.Close()
+	}
+	sh.env, sh.program, sh.uniforms, sh.subTargets = nil, 0, nil, nil
+	if to == nil || to.env == nil {
+		return nil
+	}
+
+	sh.env, sh.program, sh.uniforms, sh.vertLoc = to.env, to.program, to.uniforms, to.vertLoc
+	sh.subTargets = to.subTargets
+	to.env, to.program, to.subTargets = nil, 0, nil
+	to.Close()
+	if err := sh.bindTileOffset(sh.env); err != nil {
+		sh.env.Close()
+		gl.DeleteProgram(sh.program)
+		for _, s := range sh.subTargets {
+			s.Close()
+		}
+		sh.env, sh.program, sh.uniforms, sh.subTargets = nil, 0, nil, nil
+		return err
+	}
+	return nil
+}
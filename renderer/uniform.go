@@ -54,6 +54,77 @@ func ListUniforms(program uint32) map[string]Uniform {
 	return uniforms
 }
 
+// Set sets the value of the uniform in the program that is in use. The number
+// of values must match the number of components of its type, e.g. 3 for a
+// vec3. Integers are truncated and booleans are true if not zero.
+func (u Uniform) Set(values ...float32) error {
+	ints := func() []int32 {
+		v := make([]int32, len(values))
+		for i, f := range values {
+			v[i] = int32(f)
+			if u.Type == gl.BOOL || u.Type == gl.BOOL_VEC2 || u.Type == gl.BOOL_VEC3 || u.Type == gl.BOOL_VEC4 {
+				if f != 0 {
+					v[i] = 1
+				}
+			}
+		}
+		return v
+	}
+	n := u.Components()
+	if n == 0 {
+		return fmt.Errorf("can not set a uniform of type %s", u.TypeLiteral())
+	}
+	if len(values) != n {
+		return fmt.Errorf("a %s needs %d values, got %d", u.TypeLiteral(), n, len(values))
+	}
+
+	switch u.Type {
+	case gl.FLOAT:
+		gl.Uniform1fv(u.Location, 1, &values[0])
+	case gl.FLOAT_VEC2:
+		gl.Uniform2fv(u.Location, 1, &values[0])
+	case gl.FLOAT_VEC3:
+		gl.Uniform3fv(u.Location, 1, &values[0])
+	case gl.FLOAT_VEC4:
+		gl.Uniform4fv(u.Location, 1, &values[0])
+	case gl.INT, gl.BOOL:
+		gl.Uniform1iv(u.Location, 1, &ints()[0])
+	case gl.INT_VEC2, gl.BOOL_VEC2:
+		gl.Uniform2iv(u.Location, 1, &ints()[0])
+	case gl.INT_VEC3, gl.BOOL_VEC3:
+		gl.Uniform3iv(u.Location, 1, &ints()[0])
+	case gl.INT_VEC4, gl.BOOL_VEC4:
+		gl.Uniform4iv(u.Location, 1, &ints()[0])
+	case gl.FLOAT_MAT2:
+		gl.UniformMatrix2fv(u.Location, 1, false, &values[0])
+	case gl.FLOAT_MAT3:
+		gl.UniformMatrix3fv(u.Location, 1, false, &values[0])
+	case gl.FLOAT_MAT4:
+		gl.UniformMatrix4fv(u.Location, 1, false, &values[0])
+	}
+	return nil
+}
+
+// Components returns the number of values that Set needs for the type of the
+// uniform, or 0 if it can not be set.
+func (u Uniform) Components() int {
+	switch u.Type {
+	case gl.FLOAT, gl.INT, gl.BOOL:
+		return 1
+	case gl.FLOAT_VEC2, gl.INT_VEC2, gl.BOOL_VEC2:
+		return 2
+	case gl.FLOAT_VEC3, gl.INT_VEC3, gl.BOOL_VEC3:
+		return 3
+	case gl.FLOAT_VEC4, gl.INT_VEC4, gl.BOOL_VEC4, gl.FLOAT_MAT2:
+		return 4
+	case gl.FLOAT_MAT3:
+		return 9
+	case gl.FLOAT_MAT4:
+		return 16
+	}
+	return 0
+}
+
 func (u Uniform) TypeLiteral() string {
 	switch u.Type {
 	case gl.FLOAT:
@@ -0,0 +1,131 @@
+package renderer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// A ScaleFilter determines how the rendered image is scaled to the window of
+// an OnScreenEngine.
+type ScaleFilter int
+
+const (
+	// ScaleNearest stretches the image over the window and uses the nearest
+	// pixel.
+	ScaleNearest ScaleFilter = iota
+	// ScaleLinear stretches the image over the window and interpolates
+	// between pixels.
+	ScaleLinear
+	// ScaleInteger scales the image by the largest whole factor that fits the
+	// window and centers it, so every pixel is shown as a square of equal
+	// size. Images larger than the window are scaled down preserving the
+	// aspect ratio.
+	ScaleInteger
+)
+
+// ParseScaleFilter parses the name of a scale filter, e.g. "linear".
+func ParseScaleFilter(s string) (ScaleFilter, error) {
+	switch strings.ToLower(s) {
+	case "nearest":
+		return ScaleNearest, nil
+	case "linear":
+		return ScaleLinear, nil
+	case "integer":
+		return ScaleInteger, nil
+	}
+	return 0, fmt.Errorf("invalid scale filter: %q", s)
+}
+
+func (sf ScaleFilter) String() string {
+	switch sf {
+	case ScaleNearest:
+		return "nearest"
+	case ScaleLinear:
+		return "linear"
+	case ScaleInteger:
+		return "integer"
+	}
+	return "invalid"
+}
+
+func (sf ScaleFilter) glFilter() int32 {
+	if sf == ScaleLinear {
+		return gl.LINEAR
+	}
+	return gl.NEAREST
+}
+
+// viewport returns the area of a window of the specified size that an image
+// of the specified size is presented in.
+func (sf ScaleFilter) viewport(windowWidth, windowHeight, width, height int) (x, y, w, h int) {
+	if sf != ScaleInteger || width <= 0 || height <= 0 {
+		return 0, 0, windowWidth, windowHeight
+	}
+	f := windowWidth / width
+	if fh := windowHeight / height; fh < f {
+		f = fh
+	}
+	if f >= 1 {
+		w, h = width*f, height*f
+	} else if windowWidth*height < windowHeight*width {
+		w, h = windowWidth, height*windowWidth/width
+	} else {
+		w, h = width*windowHeight/height, windowHeight
+	}
+	return (windowWidth - w) / 2, (windowHeight - h) / 2, w, h
+}
+
+// WindowOptions configure the window of an OnScreenEngine.
+type WindowOptions struct {
+	// Width and Height are the size of the window. The default is 1366x768.
+	Width, Height int
+	// X and Y are the position of the window relative to the monitor if
+	// Positioned is set. Otherwise, the window manager decides.
+	X, Y       int
+	Positioned bool
+	// Borderless hides the decorations of the window.
+	Borderless bool
+	// Fullscreen shows the window fullscreen on the monitor.
+	Fullscreen bool
+	// Monitor is the index or name of the monitor to show the window on.
+	// The primary monitor is used if empty.
+	Monitor string
+
+	// RenderWidth and RenderHeight fix the size of the rendered image, which
+	// is then scaled to the window using Filter. If 0, the image is rendered
+	// at the size of the window multiplied by RenderScale.
+	RenderWidth, RenderHeight uint
+	// RenderScale is the size of the rendered image relative to the window,
+	// e.g. 0.5 to render heavy shaders at half the resolution. 0 means 1.
+	RenderScale float64
+	Filter      ScaleFilter
+
+	// VSync synchronizes frames to the refresh rate of the monitor.
+	VSync bool
+}
+
+// findMonitor returns the monitor with the specified index or name, or the
+// primary monitor if spec is empty.
+func findMonitor(spec string) (*glfw.Monitor, error) {
+	if spec == "" {
+		return glfw.GetPrimaryMonitor(), nil
+	}
+	monitors := glfw.GetMonitors()
+	if i, err := strconv.Atoi(spec); err == nil {
+		if i >= 0 && i < len(monitors) {
+			return monitors[i], nil
+		}
+	}
+	names := make([]string, len(monitors))
+	for i, m := range monitors {
+		if m.GetName() == spec {
+			return m, nil
+		}
+		names[i] = fmt.Sprintf("%d: %s", i, m.GetName())
+	}
+	return nil, fmt.Errorf("no monitor %q, available monitors are {%s}", spec, strings.Join(names, ", "))
+}
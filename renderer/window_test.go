@@ -0,0 +1,27 @@
+package renderer
+
+import (
+	"testing"
+)
+
+func TestScaleFilterViewport(t *testing.T) {
+	cases := []struct {
+		filter                 ScaleFilter
+		windowW, windowH       int
+		width, height          int
+		expX, expY, expW, expH int
+	}{
+		{ScaleLinear, 1366, 768, 150, 16, 0, 0, 1366, 768},
+		{ScaleInteger, 1366, 768, 150, 16, 8, 312, 1350, 144},
+		{ScaleInteger, 300, 300, 100, 100, 0, 0, 300, 300},
+		{ScaleInteger, 100, 50, 400, 100, 0, 12, 100, 25},
+		{ScaleInteger, 100, 50, 100, 100, 25, 0, 50, 50},
+	}
+	for _, c := range cases {
+		x, y, w, h := c.filter.viewport(c.windowW, c.windowH, c.width, c.height)
+		if x != c.expX || y != c.expY || w != c.expW || h != c.expH {
+			t.Errorf("unexpected %s viewport of %dx%d in %dx%d: (%d, %d, %d, %d)",
+				c.filter, c.width, c.height, c.windowW, c.windowH, x, y, w, h)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package audio
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"regexp"
 	"strconv"
@@ -15,8 +16,8 @@ import (
 )
 
 func init() {
-	shadertoy.RegisterResourceType("audio", func(m shadertoy.Mapping, genTexID shadertoy.GenTexFunc, _ renderer.RenderState) (shadertoy.Resource, error) {
-		source, err := parseMappingValue(m.PWD, m.Value)
+	shadertoy.RegisterResourceType("audio", func(m shadertoy.Mapping, genTexID shadertoy.GenTexFunc, state renderer.RenderState) (shadertoy.Resource, error) {
+		source, err := parseMappingValue(m.PWD, m.Value, state.Time)
 		if err != nil {
 			return nil, err
 		}
@@ -35,9 +36,12 @@ var (
 	pcmValueRe     = regexp.MustCompile(`^([^;]+);(\d+):(\d+):([su]\d{1,2}[lb]e)$`)
 )
 
-func parseMappingValue(pwd, value string) (*source, error) {
+// parseMappingValue opens the audio source of a mapping. Audio files and
+// regular PCM files are positioned at the start time, streams are read as
+// they are.
+func parseMappingValue(pwd, value string, start time.Duration) (*source, error) {
 	if match := genericValueRe.FindStringSubmatch(value); match != nil {
-		return newAudioFileSource(match[1])
+		return newAudioFileSource(match[1], start)
 	}
 
 	match := pcmValueRe.FindStringSubmatch(value)
@@ -65,6 +69,14 @@ func parseMappingValue(pwd, value string) (*source, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not open audio source: %w", err)
 	}
+	if info, err := fd.Stat(); err == nil && info.Mode().IsRegular() && start > 0 {
+		frameSize := int64(channels * format.Bits() / 8)
+		offset := int64(samplerate) * int64(start) / int64(time.Second) * frameSize
+		if _, err := fd.Seek(offset, io.SeekStart); err != nil {
+			fd.Close()
+			return nil, fmt.Errorf("could not seek audio source: %w", err)
+		}
+	}
 	return &source{
 		SampleRate: samplerate,
 		Channels:   channels,
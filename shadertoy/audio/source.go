@@ -16,11 +16,12 @@ type source struct {
 	file       io.ReadCloser
 }
 
-func newAudioFileSource(filename string) (*source, error) {
+func newAudioFileSource(filename string, start time.Duration) (*source, error) {
 	r, w := io.Pipe()
 	go func() {
 		cmd := exec.Command(
 			"ffmpeg",
+			"-ss", fmt.Sprintf("%.3f", start.Seconds()),
 			"-i", filename,
 			"-f", "s16le",
 			"-acodec", "pcm_s16le",
@@ -0,0 +1,144 @@
+package osc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+var bundleTag = []byte("#bundle\x00")
+
+// A message is an OSC message with arguments that can be set as uniforms.
+type message struct {
+	address string
+	values  []float32
+}
+
+// decodePacket decodes the messages in an OSC packet, which is a message or a
+// bundle of packets.
+//
+// Numbers are converted to floats and booleans to 1 and 0. Messages with
+// other arguments, like strings, are skipped. The time tags of bundles are
+// ignored, so messages take effect when they are received.
+func decodePacket(data []byte) ([]message, error) {
+	if !bytes.HasPrefix(data, bundleTag) {
+		msg, ok, err := decodeMessage(data)
+		if err != nil || !ok {
+			return nil, err
+		}
+		return []message{msg}, nil
+	}
+
+	// Skip the tag and the time tag.
+	if len(data) < 16 {
+		return nil, fmt.Errorf("truncated bundle")
+	}
+	data = data[16:]
+	var msgs []message
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("truncated bundle element")
+		}
+		size := int(binary.BigEndian.Uint32(data))
+		data = data[4:]
+		if size < 0 || size > len(data) {
+			return nil, fmt.Errorf("bundle element of %d bytes exceeds the bundle", size)
+		}
+		elemMsgs, err := decodePacket(data[:size])
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, elemMsgs...)
+		data = data[size:]
+	}
+	return msgs, nil
+}
+
+// decodeMessage decodes a message. ok is false if the message has arguments
+// that are not supported.
+func decodeMessage(data []byte) (msg message, ok bool, err error) {
+	msg.address, data, err = readString(data)
+	if err != nil {
+		return message{}, false, err
+	}
+	if len(msg.address) == 0 || msg.address[0] != '/' {
+		return message{}, false, fmt.Errorf("invalid address %q", msg.address)
+	}
+	if len(data) == 0 {
+		// A message without arguments.
+		return msg, true, nil
+	}
+	tags, data, err := readString(data)
+	if err != nil {
+		return message{}, false, err
+	}
+	if len(tags) == 0 || tags[0] != ',' {
+		return message{}, false, fmt.Errorf("message %s has no type tags", msg.address)
+	}
+
+	ok = true
+	for _, tag := range tags[1:] {
+		size := 0
+		switch tag {
+		case 'i', 'f', 'c', 'r', 'm':
+			size = 4
+		case 'h', 'd', 't':
+			size = 8
+		case 's', 'S':
+			if _, data, err = readString(data); err != nil {
+				return message{}, false, err
+			}
+			ok = false
+			continue
+		case 'b':
+			if len(data) < 4 {
+				return message{}, false, fmt.Errorf("truncated blob")
+			}
+			size = 4 + pad(int(binary.BigEndian.Uint32(data)))
+			ok = false
+		case 'T':
+			msg.values = append(msg.values, 1)
+		case 'F':
+			msg.values = append(msg.values, 0)
+		case 'N', 'I', '[', ']':
+		default:
+			return message{}, false, fmt.Errorf("message %s has the unknown type tag %q", msg.address, tag)
+		}
+		if size > len(data) || size < 0 {
+			return message{}, false, fmt.Errorf("truncated argument of message %s", msg.address)
+		}
+		switch tag {
+		case 'i':
+			msg.values = append(msg.values, float32(int32(binary.BigEndian.Uint32(data))))
+		case 'f':
+			msg.values = append(msg.values, math.Float32frombits(binary.BigEndian.Uint32(data)))
+		case 'h':
+			msg.values = append(msg.values, float32(int64(binary.BigEndian.Uint64(data))))
+		case 'd':
+			msg.values = append(msg.values, float32(math.Float64frombits(binary.BigEndian.Uint64(data))))
+		case 'c', 'r', 'm', 't':
+			ok = false
+		}
+		data = data[size:]
+	}
+	return msg, ok, nil
+}
+
+// readString reads a null terminated string that is padded to a multiple of
+// four bytes.
+func readString(data []byte) (string, []byte, error) {
+	i := bytes.IndexByte(data, 0)
+	if i < 0 {
+		return "", nil, fmt.Errorf("unterminated string")
+	}
+	n := pad(i + 1)
+	if n > len(data) {
+		return "", nil, fmt.Errorf("truncated string")
+	}
+	return string(data[:i]), data[n:], nil
+}
+
+func pad(n int) int {
+	return (n + 3) &^ 3
+}
@@ -0,0 +1,313 @@
+// Package osc maps OSC (Open Sound Control) messages that are received over
+// UDP to uniforms:
+//
+//	#pragma map ctl=osc:udp://0.0.0.0:9000?smooth=0.2
+//
+// The uniform of a message is named after the mapping and the components of
+// its address, which are capitalized, e.g. /ctl/speed sets ctlSpeed and
+// /1/fader1 sets ctl1Fader1. The shader declares the uniforms it uses, and the
+// arguments of a message must match the number of components of the type of
+// its uniform, e.g. /ctl/color fff sets a vec3.
+//
+// Parameters are set like any other control sets them, so their values are
+// checked and reported. Besides its full name, a parameter can be set by its
+// name without the mapping, e.g. /ctl/speed sets the parameter speed if the
+// shader has no uniform ctlSpeed.
+//
+// Float uniforms follow their values with a delay of about smooth seconds, so
+// controls that send coarse steps look smooth.
+package osc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/billtraill/shady/renderer"
+	"github.com/billtraill/shady/shadertoy"
+)
+
+func init() {
+	shadertoy.RegisterResourceType("osc", func(m shadertoy.Mapping, _ shadertoy.GenTexFunc, _ renderer.RenderState) (shadertoy.Resource, error) {
+		return newOSCResource(m.Name, m.Value)
+	})
+}
+
+type oscResource struct {
+	name      string
+	smoothing time.Duration
+	listener  *listener
+	params    shadertoy.ParamEnvironment
+
+	// targets are the values of the uniforms that were last received. They
+	// are handed from the listener to the render thread.
+	targetsLock sync.Mutex
+	targets     map[string][]float32
+
+	// values are the smoothed values, which are only used by the render
+	// thread.
+	values map[string][]float32
+	warned map[string]bool
+}
+
+func newOSCResource(name, value string) (*oscResource, error) {
+	addr, smoothing, err := parseURL(value)
+	if err != nil {
+		return nil, err
+	}
+	res := &oscResource{
+		name:      name,
+		smoothing: smoothing,
+		targets:   map[string][]float32{},
+		values:    map[string][]float32{},
+		warned:    map[string]bool{},
+	}
+	if res.listener, err = subscribe(addr, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// parseURL parses the value of a mapping, e.g. udp://0.0.0.0:9000?smooth=0.2.
+func parseURL(value string) (addr string, smoothing time.Duration, err error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return "", 0, err
+	}
+	if u.Scheme != "udp" {
+		return "", 0, fmt.Errorf("osc: unsupported protocol %q, expected udp", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", 0, fmt.Errorf("osc: no address to listen on in %q", value)
+	}
+	for key, values := range u.Query() {
+		switch key {
+		case "smooth":
+			s, err := strconv.ParseFloat(values[0], 64)
+			if err != nil || s < 0 {
+				return "", 0, fmt.Errorf("osc: invalid smoothing %q", values[0])
+			}
+			smoothing = time.Duration(s * float64(time.Second))
+		default:
+			return "", 0, fmt.Errorf("osc: unknown option %q", key)
+		}
+	}
+	return u.Host, smoothing, nil
+}
+
+// uniformName returns the name of the uniform that a message to the address
+// sets. A first component that equals the name of the mapping is not
+// repeated.
+func uniformName(mapping, address string) string {
+	parts := strings.FieldsFunc(address, func(r rune) bool {
+		return r == '/'
+	})
+	if len(parts) > 0 && parts[0] == mapping {
+		parts = parts[1:]
+	}
+	var name strings.Builder
+	name.WriteString(mapping)
+	for _, part := range parts {
+		// Uniform names consist of ASCII letters and digits.
+		words := strings.FieldsFunc(part, func(r rune) bool {
+			return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+		})
+		for _, w := range words {
+			name.WriteString(strings.ToUpper(w[:1]) + w[1:])
+		}
+	}
+	return name.String()
+}
+
+// smooth moves the values towards the targets by the fraction that
+// exponential smoothing covers in the interval.
+func smooth(values, targets []float32, interval, smoothing time.Duration) {
+	f := float32(1 - math.Exp(-interval.Seconds()/smoothing.Seconds()))
+	for i := range values {
+		values[i] += (targets[i] - values[i]) * f
+	}
+}
+
+func (res *oscResource) receive(msg message) {
+	res.targetsLock.Lock()
+	defer res.targetsLock.Unlock()
+	res.targets[uniformName(res.name, msg.address)] = msg.values
+}
+
+// param returns the parameter that the uniform of a message sets, which is
+// either the parameter of the same name or, if the shader has no uniform of
+// that name, the parameter that is named without the mapping.
+func (res *oscResource) param(name string, uniforms map[string]renderer.Uniform) (shadertoy.Param, bool) {
+	if res.params == nil {
+		return shadertoy.Param{}, false
+	}
+	short := strings.TrimPrefix(name, res.name)
+	if _, ok := uniforms[name]; !ok && short != "" {
+		name = strings.ToLower(short[:1]) + short[1:]
+	}
+	for _, p := range res.params.Params() {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return shadertoy.Param{}, false
+}
+
+func (res *oscResource) BindParams(env shadertoy.ParamEnvironment) {
+	res.params = env
+}
+
+func (res *oscResource) UniformSource() string {
+	return ""
+}
+
+func (res *oscResource) PreRender(state renderer.RenderState) {
+	res.targetsLock.Lock()
+	defer res.targetsLock.Unlock()
+	for name, target := range res.targets {
+		p, isParam := res.param(name, state.Uniforms)
+		if isParam {
+			name = p.Name
+		}
+		u, ok := state.Uniforms[name]
+		if !ok {
+			continue
+		}
+		values, ok := res.values[name]
+		switch u.Type {
+		case gl.FLOAT, gl.FLOAT_VEC2, gl.FLOAT_VEC3, gl.FLOAT_VEC4:
+			if ok && res.smoothing > 0 && len(values) == len(target) {
+				smooth(values, target, state.Interval, res.smoothing)
+				break
+			}
+			fallthrough
+		default:
+			values = append(values[:0], target...)
+		}
+		res.values[name] = values
+
+		if isParam {
+			// The values are smoothed in place, so the parameter gets a copy.
+			if err := res.params.SetParam(name, append([]float32(nil), values...)); err != nil {
+				if !res.warned[name] {
+					log.Printf("OSC: %v", err)
+					res.warned[name] = true
+				}
+				delete(res.values, name)
+				continue
+			}
+		}
+		if err := u.Set(values...); err != nil && !res.warned[name] {
+			log.Printf("OSC: unable to set %s: %v", name, err)
+			res.warned[name] = true
+		}
+	}
+}
+
+func (res *oscResource) Close() error {
+	res.listener.unsubscribe(res)
+	return nil
+}
+
+var (
+	listenersLock sync.Mutex
+	listeners     = map[string]*listener{}
+)
+
+// A listener receives the messages on an address for all resources that map
+// it. This allows the environment that is transitioned to to listen on the
+// same address as the one that is transitioned from.
+type listener struct {
+	addr string
+	conn net.PacketConn
+	done chan struct{}
+
+	lock        sync.Mutex
+	subscribers map[*oscResource]bool
+	// last are the values that were last received for each address, so a
+	// new subscriber starts where the previous one was.
+	last map[string][]float32
+}
+
+// subscribe starts receiving the messages on an address for a resource.
+func subscribe(addr string, res *oscResource) (*listener, error) {
+	listenersLock.Lock()
+	defer listenersLock.Unlock()
+	l, ok := listeners[addr]
+	if !ok {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("osc: %w", err)
+		}
+		l = &listener{
+			addr:        addr,
+			conn:        conn,
+			done:        make(chan struct{}),
+			subscribers: map[*oscResource]bool{},
+			last:        map[string][]float32{},
+		}
+		listeners[addr] = l
+		go l.serve()
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.subscribers[res] = true
+	for address, values := range l.last {
+		res.receive(message{address: address, values: values})
+	}
+	return l, nil
+}
+
+// unsubscribe stops receiving messages for a resource. The listener is closed
+// when it has no subscribers left.
+func (l *listener) unsubscribe(res *oscResource) {
+	listenersLock.Lock()
+	defer listenersLock.Unlock()
+	l.lock.Lock()
+	delete(l.subscribers, res)
+	n := len(l.subscribers)
+	l.lock.Unlock()
+	if n > 0 {
+		return
+	}
+	delete(listeners, l.addr)
+	l.conn.Close()
+	<-l.done
+}
+
+func (l *listener) serve() {
+	defer close(l.done)
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := l.conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			log.Printf("OSC: %v", err)
+			return
+		}
+		msgs, err := decodePacket(buf[:n])
+		if err != nil {
+			log.Printf("OSC: %v", err)
+			continue
+		}
+		l.lock.Lock()
+		for _, msg := range msgs {
+			l.last[msg.address] = msg.values
+			for res := range l.subscribers {
+				res.receive(msg)
+			}
+		}
+		l.lock.Unlock()
+	}
+}
@@ -0,0 +1,222 @@
+package osc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/billtraill/shady/renderer"
+	"github.com/billtraill/shady/shadertoy"
+)
+
+func oscString(s string) []byte {
+	b := append([]byte(s), 0)
+	return append(b, make([]byte, pad(len(b))-len(b))...)
+}
+
+// encodeMessage encodes a message with int32, float32, float64, bool and
+// string arguments.
+func encodeMessage(address string, args ...interface{}) []byte {
+	var tags, data bytes.Buffer
+	tags.WriteByte(',')
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case int32:
+			tags.WriteByte('i')
+			binary.Write(&data, binary.BigEndian, v)
+		case float32:
+			tags.WriteByte('f')
+			binary.Write(&data, binary.BigEndian, math.Float32bits(v))
+		case float64:
+			tags.WriteByte('d')
+			binary.Write(&data, binary.BigEndian, math.Float64bits(v))
+		case bool:
+			if v {
+				tags.WriteByte('T')
+			} else {
+				tags.WriteByte('F')
+			}
+		case string:
+			tags.WriteByte('s')
+			data.Write(oscString(v))
+		}
+	}
+	msg := append(oscString(address), oscString(tags.String())...)
+	return append(msg, data.Bytes()...)
+}
+
+func encodeBundle(elements ...[]byte) []byte {
+	b := append([]byte{}, bundleTag...)
+	b = append(b, 0, 0, 0, 0, 0, 0, 0, 1)
+	for _, elem := range elements {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(elem)))
+		b = append(b, size[:]...)
+		b = append(b, elem...)
+	}
+	return b
+}
+
+func TestDecodePacket(t *testing.T) {
+	packet := encodeBundle(
+		encodeMessage("/ctl/speed", float32(2.5)),
+		encodeMessage("/ctl/name", "plasma"),
+		encodeBundle(
+			encodeMessage("/ctl/color", float32(1), float64(0.5), int32(-2)),
+			encodeMessage("/ctl/on", true, false),
+		),
+	)
+	msgs, err := decodePacket(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []message{
+		{"/ctl/speed", []float32{2.5}},
+		{"/ctl/color", []float32{1, 0.5, -2}},
+		{"/ctl/on", []float32{1, 0}},
+	}
+	if !reflect.DeepEqual(msgs, expected) {
+		t.Errorf("unexpected messages: %v", msgs)
+	}
+
+	invalid := [][]byte{
+		[]byte("/ctl"),
+		encodeMessage("ctl/speed", float32(1)),
+		encodeMessage("/ctl/speed", float32(1))[:18],
+		encodeBundle(encodeMessage("/ctl/speed", float32(1)))[:24],
+	}
+	for _, packet := range invalid {
+		if _, err := decodePacket(packet); err == nil {
+			t.Errorf("expected an error for %q", packet)
+		}
+	}
+}
+
+func TestUniformName(t *testing.T) {
+	names := map[string]string{
+		"/ctl/speed":     "ctlSpeed",
+		"/ctl":           "ctl",
+		"/1/fader1":      "ctl1Fader1",
+		"/ctl/my-knob/x": "ctlMyKnobX",
+		"/control/speed": "ctlControlSpeed",
+	}
+	for address, expected := range names {
+		if name := uniformName("ctl", address); name != expected {
+			t.Errorf("unexpected name for %s: %s", address, name)
+		}
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	addr, smoothing, err := parseURL("udp://0.0.0.0:9000?smooth=0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "0.0.0.0:9000" || smoothing != 200*time.Millisecond {
+		t.Errorf("unexpected result: %s, %v", addr, smoothing)
+	}
+	for _, value := range []string{"tcp://0.0.0.0:9000", "udp://", "udp://:9000?smooth=-1", "udp://:9000?rate=1"} {
+		if _, _, err := parseURL(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
+
+type testParamEnvironment []shadertoy.Param
+
+func (env testParamEnvironment) Params() []shadertoy.Param {
+	return env
+}
+
+func (env testParamEnvironment) SetParam(name string, values []float32) error {
+	return nil
+}
+
+func TestParam(t *testing.T) {
+	res := &oscResource{name: "ctl"}
+	res.BindParams(testParamEnvironment{{Name: "speed"}, {Name: "ctlTint"}, {Name: "zoom"}})
+	uniforms := map[string]renderer.Uniform{
+		"speed":   {Name: "speed"},
+		"ctlTint": {Name: "ctlTint"},
+		"zoom":    {Name: "zoom"},
+		"ctlZoom": {Name: "ctlZoom"},
+		"ctlSize": {Name: "ctlSize"},
+	}
+	names := map[string]string{
+		"ctlSpeed": "speed",
+		"ctlTint":  "ctlTint",
+		// A uniform of the full name takes precedence.
+		"ctlZoom": "",
+		"ctlSize": "",
+		"ctl":     "",
+	}
+	for name, expected := range names {
+		p, ok := res.param(name, uniforms)
+		if ok != (expected != "") || p.Name != expected {
+			t.Errorf("unexpected parameter for %s: %q, %v", name, p.Name, ok)
+		}
+	}
+}
+
+func TestSmooth(t *testing.T) {
+	values := []float32{0, 10}
+	smooth(values, []float32{1, 0}, time.Second, time.Second)
+	f := float32(1 - math.Exp(-1))
+	if exp := []float32{f, 10 - 10*f}; !reflect.DeepEqual(values, exp) {
+		t.Errorf("unexpected values: %v", values)
+	}
+}
+
+func TestListener(t *testing.T) {
+	a := &oscResource{name: "ctl", targets: map[string][]float32{}}
+	l, err := subscribe("127.0.0.1:0", a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.listener = l
+	conn, err := net.Dial("udp", l.conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(encodeMessage("/ctl/speed", float32(2))); err != nil {
+		t.Fatal(err)
+	}
+	targets := func(res *oscResource) map[string][]float32 {
+		res.targetsLock.Lock()
+		defer res.targetsLock.Unlock()
+		targets := map[string][]float32{}
+		for name, values := range res.targets {
+			targets[name] = values
+		}
+		return targets
+	}
+	for deadline := time.Now().Add(5 * time.Second); len(targets(a)) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("no message was received")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A second resource on the same address starts with the last values.
+	b := &oscResource{name: "ctl", targets: map[string][]float32{}}
+	if b.listener, err = subscribe("127.0.0.1:0", b); err != nil || b.listener != l {
+		t.Fatalf("the listener is not shared: %v", err)
+	}
+	if exp := map[string][]float32{"ctlSpeed": {2}}; !reflect.DeepEqual(targets(b), exp) {
+		t.Errorf("unexpected values: %v", targets(b))
+	}
+
+	a.Close()
+	if _, ok := listeners["127.0.0.1:0"]; !ok {
+		t.Errorf("the listener was closed while it has a subscriber")
+	}
+	b.Close()
+	if _, ok := listeners["127.0.0.1:0"]; ok {
+		t.Errorf("the listener was not closed")
+	}
+}
@@ -0,0 +1,206 @@
+package shadertoy
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/billtraill/shady/renderer"
+)
+
+var paramSourceRe = regexp.MustCompile(`(?m)^#pragma\s+param\s+(\w+)\s+(\w+)(.*)$`)
+
+// paramComponents are the number of values of the types of parameters.
+var paramComponents = map[string]int{
+	"float": 1,
+	"int":   1,
+	"bool":  1,
+	"vec2":  2,
+	"vec3":  3,
+	"vec4":  4,
+}
+
+// A Param is a uniform that can be tweaked without editing the shader. It is
+// declared by a "#pragma param <name> <type> <default> [<min> <max>]"
+// directive, e.g.:
+//
+//	#pragma param speed float 1.0 0.0 10.0
+//	#pragma param color vec3 1.0 0.5 0.0
+//	#pragma param invert bool false
+//
+// The type is float, int, bool, vec2, vec3 or vec4. A vector has a value for
+// each component, and either a single minimum and maximum or one for each
+// component.
+type Param struct {
+	Name    string
+	Type    string
+	Default []float32
+	// Min and Max limit the values of each component if they are set.
+	Min, Max []float32
+}
+
+func parseParam(name, typ, values string) (Param, error) {
+	n, ok := paramComponents[typ]
+	if !ok {
+		return Param{}, fmt.Errorf("parameter %s has the unsupported type %q", name, typ)
+	}
+	fields := strings.Fields(values)
+	p := Param{Name: name, Type: typ}
+	if len(fields) < n {
+		return Param{}, fmt.Errorf("parameter %s is a %s, which needs %d default values", name, typ, n)
+	}
+	var err error
+	if p.Default, err = ParseParamValues(fields[:n]); err != nil {
+		return Param{}, fmt.Errorf("parameter %s: %w", name, err)
+	}
+	limits := fields[n:]
+	switch {
+	case len(limits) == 0:
+	case typ == "bool":
+		return Param{}, fmt.Errorf("parameter %s is a bool, which has no minimum and maximum", name)
+	case len(limits) == 2:
+		lim, err := ParseParamValues(limits)
+		if err != nil {
+			return Param{}, fmt.Errorf("parameter %s: %w", name, err)
+		}
+		p.Min, p.Max = make([]float32, n), make([]float32, n)
+		for i := 0; i < n; i++ {
+			p.Min[i], p.Max[i] = lim[0], lim[1]
+		}
+	case len(limits) == 2*n:
+		lim, err := ParseParamValues(limits)
+		if err != nil {
+			return Param{}, fmt.Errorf("parameter %s: %w", name, err)
+		}
+		p.Min, p.Max = lim[:n], lim[n:]
+	default:
+		return Param{}, fmt.Errorf("parameter %s has %d values after its default, expected a minimum and a maximum", name, len(limits))
+	}
+	for i := range p.Min {
+		if p.Min[i] > p.Max[i] {
+			return Param{}, fmt.Errorf("parameter %s has a minimum greater than its maximum", name)
+		}
+	}
+	if err := p.Check(p.Default); err != nil {
+		return Param{}, fmt.Errorf("invalid default: %w", err)
+	}
+	return p, nil
+}
+
+// ParseParamValues parses the values of a parameter, which are numbers or
+// true and false.
+func ParseParamValues(strs []string) ([]float32, error) {
+	values := make([]float32, len(strs))
+	for i, str := range strs {
+		switch str = strings.TrimSpace(str); str {
+		case "true":
+			values[i] = 1
+		case "false":
+			values[i] = 0
+		default:
+			f, err := strconv.ParseFloat(str, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", str)
+			}
+			values[i] = float32(f)
+		}
+	}
+	return values, nil
+}
+
+// Check returns an error if the values are not valid for the parameter.
+func (p Param) Check(values []float32) error {
+	if n := paramComponents[p.Type]; len(values) != n {
+		return fmt.Errorf("parameter %s is a %s, which needs %d values, got %d", p.Name, p.Type, n, len(values))
+	}
+	for i, v := range values {
+		if p.Type == "bool" && v != 0 && v != 1 {
+			return fmt.Errorf("parameter %s is a bool, got %g", p.Name, v)
+		}
+		if p.Type == "int" && v != float32(math.Trunc(float64(v))) {
+			return fmt.Errorf("parameter %s is an int, got %g", p.Name, v)
+		}
+		if p.Min != nil && (v < p.Min[i] || v > p.Max[i]) {
+			return fmt.Errorf("parameter %s must be between %g and %g, got %g", p.Name, p.Min[i], p.Max[i], v)
+		}
+	}
+	return nil
+}
+
+// UniformSource returns the declaration of the uniform of the parameter.
+func (p Param) UniformSource() string {
+	return fmt.Sprintf("uniform %s %s;\n", p.Type, p.Name)
+}
+
+// extractParams parses the parameters that are declared in the sources. If a
+// parameter is declared multiple times, the first declaration is used.
+func extractParams(shaderSources []renderer.SourceFile) ([]Param, error) {
+	var params []Param
+	set := map[string]bool{}
+	for _, s := range shaderSources {
+		src, err := s.Contents()
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range paramSourceRe.FindAllSubmatch(src, -1) {
+			p, err := parseParam(string(match[1]), string(match[2]), string(match[3]))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", s.Filename, err)
+			}
+			if !set[p.Name] {
+				set[p.Name] = true
+				params = append(params, p)
+			}
+		}
+	}
+	return params, nil
+}
+
+// A ParamResource is a resource that sets uniforms from live input, like a
+// control surface. It is bound to the environment when it is set up, so the
+// values of uniforms that are parameters can be set with SetParam, which
+// validates them and keeps ParamValues up to date.
+type ParamResource interface {
+	Resource
+	BindParams(env ParamEnvironment)
+}
+
+// A ParamEnvironment is an environment with parameters, like a ShaderToy.
+type ParamEnvironment interface {
+	Params() []Param
+	SetParam(name string, values []float32) error
+}
+
+// Params returns the parameters that are declared in the sources.
+func (st *ShaderToy) Params() []Param {
+	return st.params
+}
+
+// ParamValues returns the current values of the parameters.
+func (st *ShaderToy) ParamValues() map[string][]float32 {
+	values := make(map[string][]float32, len(st.params))
+	for _, p := range st.params {
+		if v, ok := st.uniformValues[p.Name]; ok {
+			values[p.Name] = v
+		}
+	}
+	return values
+}
+
+// SetParam sets the value of a parameter. While the environment is rendered,
+// it must be called on the render thread, e.g. with the Control method of the
+// engine.
+func (st *ShaderToy) SetParam(name string, values []float32) error {
+	for _, p := range st.params {
+		if p.Name == name {
+			if err := p.Check(values); err != nil {
+				return err
+			}
+			st.SetUniform(name, values)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown parameter %q", name)
+}
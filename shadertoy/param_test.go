@@ -0,0 +1,69 @@
+package shadertoy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseParam(t *testing.T) {
+	valid := map[string]Param{
+		"speed float 1.0 0.0 10.0": {Name: "speed", Type: "float", Default: []float32{1}, Min: []float32{0}, Max: []float32{10}},
+		"color vec3 1.0 0.5 0.0":   {Name: "color", Type: "vec3", Default: []float32{1, 0.5, 0}},
+		"color vec3 1 0.5 0 0 1":   {Name: "color", Type: "vec3", Default: []float32{1, 0.5, 0}, Min: []float32{0, 0, 0}, Max: []float32{1, 1, 1}},
+		"pos vec2 0 0 -1 -2 1 2":   {Name: "pos", Type: "vec2", Default: []float32{0, 0}, Min: []float32{-1, -2}, Max: []float32{1, 2}},
+		"invert bool false":        {Name: "invert", Type: "bool", Default: []float32{0}},
+		"count int 3 1 10":         {Name: "count", Type: "int", Default: []float32{3}, Min: []float32{1}, Max: []float32{10}},
+	}
+	for str, expected := range valid {
+		match := paramSourceRe.FindStringSubmatch("#pragma param " + str)
+		if match == nil {
+			t.Errorf("no match for %q", str)
+			continue
+		}
+		p, err := parseParam(match[1], match[2], match[3])
+		if err != nil {
+			t.Errorf("error parsing valid parameter %q: %v", str, err)
+			continue
+		}
+		if !reflect.DeepEqual(p, expected) {
+			t.Errorf("mismatched result for %q: %+v", str, p)
+		}
+	}
+
+	invalid := []string{
+		"speed float",
+		"speed double 1.0",
+		"speed float fast",
+		"speed float 1.0 0.0",
+		"speed float 20.0 0.0 10.0",
+		"speed float 1.0 10.0 0.0",
+		"color vec3 1.0 0.5",
+		"color vec3 1 0.5 0 0 0 0 1",
+		"invert bool true false true",
+		"invert bool 2",
+		"count int 1.5",
+	}
+	for _, str := range invalid {
+		match := paramSourceRe.FindStringSubmatch("#pragma param " + str)
+		if match == nil {
+			continue
+		}
+		if _, err := parseParam(match[1], match[2], match[3]); err == nil {
+			t.Errorf("expected an error for %q", str)
+		}
+	}
+}
+
+func TestParamCheck(t *testing.T) {
+	p := Param{Name: "count", Type: "int", Default: []float32{3}, Min: []float32{1}, Max: []float32{10}}
+	for _, values := range [][]float32{{1}, {10}} {
+		if err := p.Check(values); err != nil {
+			t.Errorf("unexpected error for %v: %v", values, err)
+		}
+	}
+	for _, values := range [][]float32{{0}, {11}, {2.5}, {1, 2}} {
+		if err := p.Check(values); err == nil {
+			t.Errorf("expected an error for %v", values)
+		}
+	}
+}
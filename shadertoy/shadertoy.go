@@ -2,6 +2,7 @@ package shadertoy
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -19,8 +20,6 @@ var (
 	IchannelNumRe        = regexp.MustCompile(`^iChannel(\d+)$`)
 )
 
-var texIndexEnum uint32
-
 // A resource builder function a resource from instantiates a mapping
 // definition that can offer additional functionality to the renderer.
 //
@@ -48,6 +47,9 @@ type ShaderToy struct {
 	glslVersion   string
 
 	resources []Resource
+	params    []Param
+	// uniformValues are set in every frame, see SetUniforms.
+	uniformValues map[string][]float32
 }
 
 func NewShaderToy(
@@ -60,15 +62,41 @@ func NewShaderToy(
 		return nil, err
 	}
 	mappings := deduplicateMappings(append(overrideMappings, sourceMappings...)...)
+	params, err := extractParams(shaderSources)
+	if err != nil {
+		return nil, err
+	}
+	uniformValues := map[string][]float32{}
+	for _, p := range params {
+		uniformValues[p.Name] = p.Default
+	}
 
 	return &ShaderToy{
 		shaderSources: shaderSources,
 		mappings:      mappings,
 		glslVersion:   glslVersion,
+		params:        params,
+		uniformValues: uniformValues,
 		// resources is populated by Setup().
 	}, nil
 }
 
+// Mappings returns the mappings of the environment, with those set on the
+// command line taking precedence over those declared in the sources.
+func (st ShaderToy) Mappings() []Mapping {
+	return st.mappings
+}
+
+// UsesPreviousFrame implements renderer.PreviousFrameEnvironment.
+func (st ShaderToy) UsesPreviousFrame() bool {
+	for _, m := range st.mappings {
+		if m.Namespace == "builtin" && m.Value == "Back Buffer" {
+			return true
+		}
+	}
+	return false
+}
+
 func (st ShaderToy) Sources() (map[renderer.Stage][]renderer.Source, error) {
 	return map[renderer.Stage][]renderer.Source{
 		renderer.StageVertex: {renderer.SourceBuf(fmt.Sprintf(`
@@ -95,12 +123,16 @@ func (st ShaderToy) Sources() (map[renderer.Stage][]renderer.Source, error) {
 			for _, res := range st.resources {
 				ss = append(ss, renderer.SourceBuf(res.UniformSource()))
 			}
+			for _, p := range st.params {
+				ss = append(ss, renderer.SourceBuf(p.UniformSource()))
+			}
 			for _, s := range st.shaderSources {
 				ss = append(ss, s)
 			}
 			ss = append(ss, renderer.SourceBuf(`
+				uniform vec2 `+renderer.TileOffsetUniform+`;
 				void main(void) {
-					vec2 pos = gl_FragCoord.xy;
+					vec2 pos = gl_FragCoord.xy + `+renderer.TileOffsetUniform+`;
 					pos.y = iResolution.y - pos.y - 1;
 					mainImage(gl_FragColor, pos);
 				}
@@ -114,11 +146,22 @@ func (st *ShaderToy) Setup(state renderer.RenderState) error {
 	if st.resources != nil {
 		return fmt.Errorf("double call to ShaderToy.Setup")
 	}
+	// Texture units are bound when rendering, so every environment can
+	// number them from zero.
+	var texIndex uint32
+	genTexID := func() uint32 {
+		id := texIndex
+		texIndex++
+		return id
+	}
 	for _, mapping := range st.mappings {
-		res, err := mapping.resource(state)
+		res, err := mapping.resource(state, genTexID)
 		if err != nil {
 			return err
 		}
+		if pr, ok := res.(ParamResource); ok {
+			pr.BindParams(st)
+		}
 		st.resources = append(st.resources, res)
 	}
 	// If no mappings are found, we're good to go. If iChannels are referenced
@@ -156,7 +199,7 @@ func (st ShaderToy) PreRender(state renderer.RenderState) {
 		gl.Uniform1f(loc.Location, float32(state.Interval)/float32(time.Second))
 	}
 	if loc, ok := state.Uniforms["iDate"]; ok {
-		t := time.Now()
+		t := state.Date
 		sinceMidnight := t.Sub(t.Truncate(time.Hour * 24))
 		gl.Uniform4f(loc.Location,
 			float32(t.Year()-1),
@@ -168,11 +211,40 @@ func (st ShaderToy) PreRender(state renderer.RenderState) {
 	if loc, ok := state.Uniforms["iFrame"]; ok {
 		gl.Uniform1f(loc.Location, float32(state.FramesProcessed))
 	}
+	for name, values := range st.uniformValues {
+		u, ok := state.Uniforms[name]
+		if !ok {
+			continue
+		}
+		if err := u.Set(values...); err != nil {
+			log.Printf("Unable to set uniform %s: %v", name, err)
+			delete(st.uniformValues, name)
+		}
+	}
+	// Resources are rendered last, so live inputs like OSC override the
+	// fixed values of uniforms and parameters.
 	for _, resource := range st.resources {
 		resource.PreRender(state)
 	}
 }
 
+// SetUniforms sets uniforms that are declared in the shader sources to fixed
+// values, see renderer.Uniform.Set. Uniforms that are not used by the shader
+// are ignored and the values of other uniforms are kept.
+func (st *ShaderToy) SetUniforms(values map[string][]float32) {
+	for name, v := range values {
+		st.SetUniform(name, v)
+	}
+}
+
+// SetUniform is like SetUniforms, but sets a single uniform.
+func (st *ShaderToy) SetUniform(name string, values []float32) {
+	if st.uniformValues == nil {
+		st.uniformValues = map[string][]float32{}
+	}
+	st.uniformValues[name] = values
+}
+
 func (st *ShaderToy) Close() error {
 	var errors []string
 	for _, res := range st.resources {
@@ -250,16 +322,11 @@ func deduplicateMappings(inMappings ...Mapping) []Mapping {
 	return outMappings
 }
 
-func (m Mapping) resource(state renderer.RenderState) (Resource, error) {
+func (m Mapping) resource(state renderer.RenderState, genTexID GenTexFunc) (Resource, error) {
 	fn, ok := resourceBuilders[m.Namespace]
 	if !ok {
 		return nil, fmt.Errorf("don't know how to map %s", m.Namespace)
 	}
-	genTexID := func() uint32 {
-		id := texIndexEnum
-		texIndexEnum++
-		return id
-	}
 	return fn(m, genTexID, state)
 }
 
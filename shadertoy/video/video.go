@@ -177,8 +177,8 @@ func decodeVideoFile(ctx context.Context, filename string, currentTime time.Dura
 			cmd := exec.CommandContext(
 				ctx,
 				"ffmpeg",
+				"-ss", fmt.Sprintf("%.3f", seekToOffset.Seconds()),
 				"-i", filename,
-				"-ss", fmt.Sprintf("%.2f", seekToOffset.Seconds()),
 				"-f", "rawvideo",
 				"-pix_fmt", "rgb24",
 				"-",
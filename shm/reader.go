@@ -0,0 +1,179 @@
+// +build linux
+
+package shm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// A Frame is a frame in the ring buffer. The pixels are not copied, so they
+// may be overwritten by the writer at any time. Check Valid after using them.
+type Frame struct {
+	// Number is the number of the frame, starting at 0.
+	Number uint64
+	// Time is the time at which the frame was published.
+	Time          time.Time
+	Width, Height int
+	Format        uint32
+	// Pix holds the pixels, referring directly to the shared memory.
+	Pix []byte
+	// Missed is the number of frames that were skipped since the previous
+	// frame returned by the reader.
+	Missed uint64
+
+	slot []byte
+}
+
+// Valid reports whether the frame has not been overwritten by the writer
+// since it was returned.
+func (f *Frame) Valid() bool {
+	return atomic.LoadUint64(uint64At(f.slot, 0)) == f.Number+1
+}
+
+// Image returns the pixels as an image without copying them.
+func (f *Frame) Image() *image.RGBA {
+	return &image.RGBA{
+		Pix:    f.Pix,
+		Stride: f.Width * 4,
+		Rect:   image.Rect(0, 0, f.Width, f.Height),
+	}
+}
+
+// A Reader reads frames published by a Writer.
+type Reader struct {
+	mem      []byte
+	conn     net.Conn
+	numSlots uint64
+	slotSize int
+	next     uint64
+	started  bool
+}
+
+// Open maps the shared memory file at path and connects to its notification
+// socket.
+func Open(path string) (*Reader, error) {
+	// Connect first, so no notification is missed after the memory is
+	// mapped.
+	conn, err := net.Dial("unix", SocketPath(path))
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if info.Size() < HeaderSize {
+		conn.Close()
+		return nil, fmt.Errorf("%s is too small to be a shared memory file", path)
+	}
+	mem, err := unix.Mmap(int(file.Fd()), 0, int(info.Size()), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	le := binary.LittleEndian
+	if string(mem[0:8]) != Magic || le.Uint32(mem[8:]) != Version {
+		unix.Munmap(mem)
+		conn.Close()
+		return nil, fmt.Errorf("%s is not a version %d shared memory file", path, Version)
+	}
+	r := &Reader{
+		mem:      mem,
+		conn:     conn,
+		numSlots: uint64(le.Uint32(mem[12:])),
+		slotSize: int(le.Uint32(mem[28:])),
+	}
+	if HeaderSize+int(r.numSlots)*r.slotSize > len(mem) {
+		r.Close()
+		return nil, fmt.Errorf("%s is truncated", path)
+	}
+	return r, nil
+}
+
+// Size returns the dimensions of the frames.
+func (r *Reader) Size() (width, height int) {
+	le := binary.LittleEndian
+	return int(le.Uint32(r.mem[16:])), int(le.Uint32(r.mem[20:]))
+}
+
+// Next returns the next frame, waiting for it to be published if needed.
+//
+// The first call returns the latest frame. After that, frames are returned in
+// order as long as they are still in the ring buffer. If the reader fell
+// behind, the oldest available frame is returned and Missed is set.
+//
+// When the writer is closed, an io.EOF error is returned.
+func (r *Reader) Next() (*Frame, error) {
+	var buf [8]byte
+	// lost counts the frames whose slots were being overwritten.
+	var lost uint64
+	for {
+		latest := atomic.LoadUint64(uint64At(r.mem, 32))
+		if latest > 0 && !r.started {
+			r.next, r.started = latest-1, true
+		}
+		if r.started && r.next < latest {
+			var missed uint64
+			if oldest := int64(latest) - int64(r.numSlots); int64(r.next) < oldest {
+				missed, r.next = uint64(oldest)-r.next, uint64(oldest)
+			}
+			if f, ok := r.frame(r.next); ok {
+				f.Missed = missed + lost
+				r.next++
+				return f, nil
+			}
+			// The slot is being overwritten, so the frame is lost.
+			lost += missed + 1
+			r.next++
+			continue
+		}
+		if _, err := r.conn.Read(buf[:]); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (r *Reader) frame(n uint64) (*Frame, bool) {
+	slot := r.mem[HeaderSize+int(n%r.numSlots)*r.slotSize:][:r.slotSize]
+	if atomic.LoadUint64(uint64At(slot, 0)) != n+1 {
+		return nil, false
+	}
+	le := binary.LittleEndian
+	size := int(le.Uint32(slot[28:]))
+	if SlotHeaderSize+size > len(slot) {
+		return nil, false
+	}
+	f := &Frame{
+		Number: n,
+		Time:   time.Unix(0, int64(le.Uint64(slot[8:]))),
+		Width:  int(le.Uint32(slot[16:])),
+		Height: int(le.Uint32(slot[20:])),
+		Format: le.Uint32(slot[24:]),
+		Pix:    slot[SlotHeaderSize : SlotHeaderSize+size],
+		slot:   slot,
+	}
+	return f, f.Valid()
+}
+
+// Close unmaps the memory and disconnects from the writer. Frames returned by
+// the reader must not be used afterwards.
+func (r *Reader) Close() error {
+	r.conn.Close()
+	return unix.Munmap(r.mem)
+}
@@ -0,0 +1,244 @@
+// +build linux
+
+// Package shm implements a frame transport for consumers on the same host.
+//
+// Frames are published in a ring buffer in a shared memory file, so they can
+// be read without copying. A Unix socket next to the file notifies connected
+// readers of every new frame.
+//
+// The file starts with a header of HeaderSize bytes, followed by the slots of
+// the ring. Frame n is stored in slot n % NumSlots. All values are little
+// endian.
+//
+//	Header:
+//	  0  [8]byte  Magic
+//	  8  uint32   Version
+//	  12 uint32   Number of slots
+//	  16 uint32   Width
+//	  20 uint32   Height
+//	  24 uint32   Pixel format
+//	  28 uint32   Slot size in bytes, including the slot header
+//	  32 uint64   Number of the latest complete frame plus one, 0 if none
+//	Slot:
+//	  0  uint64   Frame number plus one, 0 while the slot is being written
+//	  8  int64    Timestamp in nanoseconds since the Unix epoch
+//	  16 uint32   Width
+//	  20 uint32   Height
+//	  24 uint32   Pixel format
+//	  28 uint32   Payload size in bytes
+//	  32 []byte   Payload
+//
+// The notification sent over the socket is the frame number as uint64.
+package shm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Magic identifies a shady shared memory file.
+	Magic = "SHADYSHM"
+	// Version is the version of the layout.
+	Version = 1
+	// HeaderSize is the size of the file header.
+	HeaderSize = 64
+	// SlotHeaderSize is the size of the header of each slot.
+	SlotHeaderSize = 32
+	// DefaultNumSlots is the number of frames in the ring buffer if none is
+	// specified.
+	DefaultNumSlots = 4
+)
+
+const (
+	// FormatRGBA8 stores pixels as 8 bit R, G, B, A in row-major order.
+	FormatRGBA8 uint32 = 1
+)
+
+// Path resolves the name of a shared memory output. Names without a directory
+// are placed in /dev/shm, so the memory is not backed by a disk.
+func Path(name string) string {
+	if !strings.Contains(name, "/") {
+		return filepath.Join("/dev/shm", name)
+	}
+	return name
+}
+
+// SocketPath returns the path of the notification socket for the file at
+// path.
+func SocketPath(path string) string {
+	return path + ".sock"
+}
+
+// A Writer publishes frames to a shared memory file.
+type Writer struct {
+	path      string
+	mem       []byte
+	numSlots  int
+	slotSize  int
+	frameSize int
+	frame     uint64
+
+	listener net.Listener
+	lock     sync.Mutex
+	clients  map[chan uint64]struct{}
+	closed   bool
+}
+
+// Create creates the shared memory file and notification socket for frames of
+// the specified size. Existing files are replaced.
+func Create(path string, width, height, numSlots int) (*Writer, error) {
+	if numSlots <= 0 {
+		numSlots = DefaultNumSlots
+	}
+	frameSize := width * height * 4
+	slotSize := (SlotHeaderSize + frameSize + 7) &^ 7
+
+	os.Remove(path)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	size := HeaderSize + numSlots*slotSize
+	if err := file.Truncate(int64(size)); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	mem, err := unix.Mmap(int(file.Fd()), 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	le := binary.LittleEndian
+	copy(mem[0:8], Magic)
+	le.PutUint32(mem[8:], Version)
+	le.PutUint32(mem[12:], uint32(numSlots))
+	le.PutUint32(mem[16:], uint32(width))
+	le.PutUint32(mem[20:], uint32(height))
+	le.PutUint32(mem[24:], FormatRGBA8)
+	le.PutUint32(mem[28:], uint32(slotSize))
+
+	sockPath := SocketPath(path)
+	os.Remove(sockPath)
+	listener, err := net.Listen("unix", sockPath)
+	if err != nil {
+		unix.Munmap(mem)
+		os.Remove(path)
+		return nil, err
+	}
+	w := &Writer{
+		path:      path,
+		mem:       mem,
+		numSlots:  numSlots,
+		slotSize:  slotSize,
+		frameSize: frameSize,
+		listener:  listener,
+		clients:   map[chan uint64]struct{}{},
+	}
+	go w.accept()
+	return w, nil
+}
+
+// WriteFrame copies the pixels of a frame into the next slot and notifies
+// the readers.
+func (w *Writer) WriteFrame(pix []byte, timestamp time.Time) error {
+	if len(pix) != w.frameSize {
+		return fmt.Errorf("frame size changed from %d to %d bytes", w.frameSize, len(pix))
+	}
+	le := binary.LittleEndian
+	slot := w.mem[HeaderSize+int(w.frame%uint64(w.numSlots))*w.slotSize:]
+	// Readers detect that the slot was overwritten while reading it by
+	// comparing the frame number before and after.
+	atomic.StoreUint64(uint64At(slot, 0), 0)
+	le.PutUint64(slot[8:], uint64(timestamp.UnixNano()))
+	copy(slot[16:24], w.mem[16:24])
+	le.PutUint32(slot[24:], FormatRGBA8)
+	le.PutUint32(slot[28:], uint32(len(pix)))
+	copy(slot[SlotHeaderSize:], pix)
+	atomic.StoreUint64(uint64At(slot, 0), w.frame+1)
+	atomic.StoreUint64(uint64At(w.mem, 32), w.frame+1)
+
+	w.notify(w.frame)
+	w.frame++
+	return nil
+}
+
+// Close stops notifying readers and removes the file and socket. Readers that
+// have the file mapped can continue to read the last frames.
+func (w *Writer) Close() error {
+	err := w.listener.Close()
+	w.lock.Lock()
+	w.closed = true
+	for client := range w.clients {
+		close(client)
+	}
+	w.clients = map[chan uint64]struct{}{}
+	w.lock.Unlock()
+	os.Remove(w.path)
+	if mErr := unix.Munmap(w.mem); err == nil {
+		err = mErr
+	}
+	return err
+}
+
+func (w *Writer) accept() {
+	for {
+		conn, err := w.listener.Accept()
+		if err != nil {
+			return
+		}
+		client := make(chan uint64, 1)
+		w.lock.Lock()
+		if w.closed {
+			w.lock.Unlock()
+			conn.Close()
+			return
+		}
+		w.clients[client] = struct{}{}
+		w.lock.Unlock()
+		go func() {
+			defer conn.Close()
+			var buf [8]byte
+			for frame := range client {
+				binary.LittleEndian.PutUint64(buf[:], frame)
+				if _, err := conn.Write(buf[:]); err != nil {
+					break
+				}
+			}
+			w.lock.Lock()
+			delete(w.clients, client)
+			w.lock.Unlock()
+		}()
+	}
+}
+
+// notify sends the frame number to all readers. A reader that has not yet
+// received the previous notification only receives the latest one, it can
+// find out which frames it missed from the frame numbers.
+func (w *Writer) notify(frame uint64) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for client := range w.clients {
+		select {
+		case <-client:
+		default:
+		}
+		client <- frame
+	}
+}
+
+func uint64At(b []byte, offset int) *uint64 {
+	return (*uint64)(unsafe.Pointer(&b[offset]))
+}
@@ -0,0 +1,121 @@
+// +build linux
+
+package shm
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWriterReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frames")
+	w, err := Create(path, 2, 1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	frame := func(n byte) []byte {
+		return bytes.Repeat([]byte{n}, 2*1*4)
+	}
+	if err := w.WriteFrame(frame(0), time.Unix(1, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if width, height := r.Size(); width != 2 || height != 1 {
+		t.Fatalf("unexpected size: %dx%d", width, height)
+	}
+
+	// The first frame read is the latest.
+	f, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Number != 0 || !bytes.Equal(f.Pix, frame(0)) || !f.Time.Equal(time.Unix(1, 0)) || f.Width != 2 || f.Height != 1 {
+		t.Fatalf("unexpected frame: %+v", f)
+	}
+
+	// Frames are read in order while they are in the ring buffer.
+	for i := byte(1); i <= 2; i++ {
+		if err := w.WriteFrame(frame(i), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := byte(1); i <= 2; i++ {
+		f, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Number != uint64(i) || f.Missed != 0 || !bytes.Equal(f.Pix, frame(i)) {
+			t.Fatalf("unexpected frame: %+v", f)
+		}
+	}
+
+	// Frames that have been overwritten are reported as missed.
+	for i := byte(3); i <= 9; i++ {
+		if err := w.WriteFrame(frame(i), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f.Valid() {
+		t.Errorf("frame %d should have been overwritten", f.Number)
+	}
+	f, err = r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Number != 6 || f.Missed != 3 || !bytes.Equal(f.Pix, frame(6)) {
+		t.Fatalf("unexpected frame: %+v", f)
+	}
+
+	// A blocked reader is woken up by the notification.
+	for i := 0; i < 3; i++ {
+		if _, err := r.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		time.Sleep(time.Millisecond * 10)
+		w.WriteFrame(frame(10), time.Now())
+	}()
+	if f, err = r.Next(); err != nil {
+		t.Fatal(err)
+	} else if f.Number != 10 {
+		t.Fatalf("unexpected frame: %+v", f)
+	}
+	<-written
+
+	// A frame whose slot is being overwritten is skipped and reported as
+	// missed.
+	for i := byte(11); i <= 12; i++ {
+		if err := w.WriteFrame(frame(i), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	atomic.StoreUint64(uint64At(w.mem[HeaderSize+11%4*w.slotSize:], 0), 0)
+	if f, err = r.Next(); err != nil {
+		t.Fatal(err)
+	} else if f.Number != 12 || f.Missed != 1 {
+		t.Fatalf("unexpected frame: %+v", f)
+	}
+
+	if err := w.WriteFrame(frame(0)[:4], time.Now()); err == nil {
+		t.Errorf("expected an error when the frame size changes")
+	}
+
+	w.Close()
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("expected EOF after the writer was closed, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package transition
+
+// Builtin are the transitions that can be referred to by name.
+var Builtin = map[string]string{
+	"fade": `
+		vec4 transition(vec2 uv) {
+			return mix(getFromColor(uv), getToColor(uv), progress);
+		}
+	`,
+
+	// wipe moves an edge from the left to the right.
+	"wipe": `
+		uniform float smoothness; // = 0.1
+
+		vec4 transition(vec2 uv) {
+			float s = max(smoothness, 0.0001);
+			float edge = progress * (1.0 + s);
+			return mix(getToColor(uv), getFromColor(uv), smoothstep(edge - s, edge, uv.x));
+		}
+	`,
+
+	// dissolve shows the incoming pixels in a random order.
+	"dissolve": `
+		float random(vec2 co) {
+			return fract(sin(dot(co, vec2(12.9898, 78.233))) * 43758.5453);
+		}
+
+		vec4 transition(vec2 uv) {
+			return mix(getFromColor(uv), getToColor(uv), step(random(uv), progress));
+		}
+	`,
+
+	// zoom zooms into the outgoing image while the incoming image grows to its
+	// full size.
+	"zoom": `
+		uniform float zoom; // = 2.0
+
+		vec4 transition(vec2 uv) {
+			vec2 center = vec2(0.5);
+			vec4 a = getFromColor(center + (uv - center) / mix(1.0, zoom, progress));
+			vec4 b = getToColor(center + (uv - center) * mix(zoom, 1.0, progress));
+			return mix(a, b, smoothstep(0.0, 1.0, progress));
+		}
+	`,
+}
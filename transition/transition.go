@@ -0,0 +1,226 @@
+// Package transition implements transitions between environments in the style
+// of GL Transitions, https://gl-transitions.com.
+//
+// A transition is GLSL code that defines a function that returns the color at
+// a position during the transition:
+//
+//	vec4 transition(vec2 uv);
+//
+// uv is (0, 0) in the bottom left corner and (1, 1) in the top right corner.
+// The code can use the progress of the transition from 0 to 1 as the float
+// progress, the aspect ratio of the image as the float ratio and the colors of
+// the images that are transitioned between as getFromColor(uv) and
+// getToColor(uv). Uniforms that are declared with a default value in a comment
+// are set to that value:
+//
+//	uniform float smoothness; // = 0.1
+package transition
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/billtraill/shady/renderer"
+)
+
+var (
+	defaultRe = regexp.MustCompile(`(?m)^\s*uniform\s+\w+\s+(\w+)\s*;\s*//\s*=\s*(.+?)\s*$`)
+	numberRe  = regexp.MustCompile(`[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?`)
+)
+
+// A Source is the code of a transition.
+type Source struct {
+	renderer.Source
+	// Defaults are the default values of uniforms.
+	Defaults map[string][]float32
+}
+
+// Load returns the built-in transition with the specified name, or reads a
+// transition from a file.
+func Load(nameOrFile string) (*Source, error) {
+	var src renderer.Source
+	if code, ok := Builtin[nameOrFile]; ok {
+		src = renderer.SourceBuf(code)
+	} else {
+		src = renderer.SourceFile{Filename: nameOrFile}
+	}
+	code, err := src.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load transition %q: %w", nameOrFile, err)
+	}
+	return &Source{Source: src, Defaults: parseDefaults(string(code))}, nil
+}
+
+// parseDefaults extracts the default values of uniforms from comments. Booleans
+// are 1 if true and 0 if false.
+func parseDefaults(code string) map[string][]float32 {
+	defaults := map[string][]float32{}
+	for _, match := range defaultRe.FindAllStringSubmatch(code, -1) {
+		var values []float32
+		switch match[2] {
+		case "true":
+			values = []float32{1}
+		case "false":
+			values = []float32{0}
+		default:
+			// Skip the constructor, e.g. vec2 in vec2(1.0, 0.0).
+			value := match[2]
+			if i := strings.IndexByte(value, '('); i >= 0 {
+				value = value[i+1:]
+			}
+			for _, num := range numberRe.FindAllString(value, -1) {
+				f, _ := strconv.ParseFloat(num, 32)
+				values = append(values, float32(f))
+			}
+		}
+		if len(values) > 0 {
+			defaults[match[1]] = values
+		}
+	}
+	return defaults
+}
+
+// A Transition is a renderer.Transition that renders a transition Source.
+type Transition struct {
+	to          renderer.Environment
+	source      *Source
+	duration    time.Duration
+	glslVersion string
+
+	width, height uint
+	start         time.Duration
+	started       bool
+	done          bool
+}
+
+// New creates a transition to an environment that takes the specified
+// duration.
+func New(to renderer.Environment, source *Source, duration time.Duration, glslVersion string) *Transition {
+	return &Transition{
+		to:          to,
+		source:      source,
+		duration:    duration,
+		glslVersion: glslVersion,
+	}
+}
+
+// To implements the renderer.Transition interface.
+func (tr *Transition) To() renderer.Environment {
+	return tr.to
+}
+
+// Done implements the renderer.Transition interface.
+func (tr *Transition) Done() bool {
+	return tr.done
+}
+
+// Sources implements the renderer.Environment interface.
+//
+// The buffers are upside down compared to GL Transitions, because the first
+// row of an image is its top row.
+func (tr *Transition) Sources() (map[renderer.Stage][]renderer.Source, error) {
+	return map[renderer.Stage][]renderer.Source{
+		renderer.StageVertex: {renderer.SourceBuf(fmt.Sprintf(`
+			#version %s
+			attribute vec3 vert;
+			void main(void) {
+				gl_Position = vec4(vert, 1.0);
+			}
+		`, tr.glslVersion))},
+		renderer.StageFragment: {
+			renderer.SourceBuf(fmt.Sprintf(`
+				#version %s
+				uniform sampler2D shadyTransitionFrom;
+				uniform sampler2D shadyTransitionTo;
+				uniform vec2 shadyTransitionResolution;
+				uniform float progress;
+				uniform float ratio;
+				vec4 getFromColor(vec2 uv) {
+					return texture(shadyTransitionFrom, vec2(uv.x, 1.0 - uv.y));
+				}
+				vec4 getToColor(vec2 uv) {
+					return texture(shadyTransitionTo, vec2(uv.x, 1.0 - uv.y));
+				}
+			`, tr.glslVersion)),
+			tr.source,
+			renderer.SourceBuf(`
+				uniform vec2 ` + renderer.TileOffsetUniform + `;
+				void main(void) {
+					vec2 pos = gl_FragCoord.xy + ` + renderer.TileOffsetUniform + `;
+					vec2 res = shadyTransitionResolution;
+					gl_FragColor = transition(vec2(pos.x, res.y - pos.y) / res);
+				}
+			`),
+		},
+	}, nil
+}
+
+// Setup implements the renderer.Environment interface.
+func (tr *Transition) Setup(state renderer.RenderState) error {
+	tr.width, tr.height = state.CanvasWidth, state.CanvasHeight
+	return nil
+}
+
+// SubEnvironments implements the renderer.Environment interface.
+func (tr *Transition) SubEnvironments() (map[string]renderer.SubEnvironment, error) {
+	return map[string]renderer.SubEnvironment{
+		renderer.TransitionTo: {Environment: tr.to, Width: tr.width, Height: tr.height},
+	}, nil
+}
+
+// PreRender implements the renderer.Environment interface.
+func (tr *Transition) PreRender(state renderer.RenderState) {
+	if !tr.started {
+		tr.start, tr.started = state.Time, true
+	}
+	progress := 1.0
+	if tr.duration > 0 {
+		progress = float64(state.Time-tr.start) / float64(tr.duration)
+	}
+	if progress >= 1 {
+		progress, tr.done = 1, true
+	}
+
+	samplers := []struct{ uniform, buffer string }{
+		{"shadyTransitionFrom", renderer.TransitionFrom},
+		{"shadyTransitionTo", renderer.TransitionTo},
+	}
+	for i, s := range samplers {
+		if loc, ok := state.Uniforms[s.uniform]; ok {
+			gl.ActiveTexture(gl.TEXTURE0 + uint32(i))
+			gl.BindTexture(gl.TEXTURE_2D, state.SubBuffers[s.buffer])
+			gl.Uniform1i(loc.Location, int32(i))
+		}
+	}
+	if loc, ok := state.Uniforms["shadyTransitionResolution"]; ok {
+		gl.Uniform2f(loc.Location, float32(tr.width), float32(tr.height))
+	}
+	if loc, ok := state.Uniforms["progress"]; ok {
+		gl.Uniform1f(loc.Location, float32(progress))
+	}
+	if loc, ok := state.Uniforms["ratio"]; ok {
+		gl.Uniform1f(loc.Location, float32(tr.width)/float32(tr.height))
+	}
+	for name, values := range tr.source.Defaults {
+		u, ok := state.Uniforms[name]
+		if !ok {
+			continue
+		}
+		if err := u.Set(values...); err != nil {
+			log.Printf("Unable to set transition uniform %s: %v", name, err)
+			delete(tr.source.Defaults, name)
+		}
+	}
+}
+
+// Close implements the renderer.Environment interface. The environment that
+// is transitioned to is closed by the engine.
+func (tr *Transition) Close() error {
+	return nil
+}
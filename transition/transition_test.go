@@ -0,0 +1,43 @@
+package transition
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDefaults(t *testing.T) {
+	code := `
+		uniform float smoothness; // = 0.5
+		uniform vec2 direction;// = vec2(1.0, -1.0)
+		uniform ivec2 squares; // = ivec2(10,10)
+		uniform bool invert; // = false
+		uniform vec4 shadow; // = vec4(0.,0.,0.,.6)
+		uniform float noDefault;
+		// uniform float commented; // = 1.0
+	`
+	expected := map[string][]float32{
+		"smoothness": {0.5},
+		"direction":  {1, -1},
+		"squares":    {10, 10},
+		"invert":     {0},
+		"shadow":     {0, 0, 0, 0.6},
+	}
+	if defaults := parseDefaults(code); !reflect.DeepEqual(defaults, expected) {
+		t.Errorf("unexpected defaults: %v", defaults)
+	}
+}
+
+func TestLoadBuiltin(t *testing.T) {
+	for name := range Builtin {
+		src, err := Load(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "zoom" && !reflect.DeepEqual(src.Defaults["zoom"], []float32{2}) {
+			t.Errorf("unexpected defaults of zoom: %v", src.Defaults)
+		}
+	}
+	if _, err := Load("nonexistent.glsl"); err == nil {
+		t.Errorf("expected an error for a nonexistent transition")
+	}
+}